@@ -0,0 +1,93 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"fmt"
+	"strings"
+)
+
+const ConfigOnInfoKeyName = "on_info"
+const ConfigOnWarnKeyName = "on_warn"
+const ConfigOnErrorKeyName = "on_error"
+const ConfigOnFatalKeyName = "on_fatal"
+const ConfigExitCodeKeyName = "exit_code"
+
+// DefaultExitCode is the exit code of ActionExit.
+const DefaultExitCode = 1
+
+// ConfigActionKeyNames is the configuration name of the action of each Severity.
+var ConfigActionKeyNames = map[Severity]string{
+	SeverityInfo:    ConfigOnInfoKeyName,
+	SeverityWarning: ConfigOnWarnKeyName,
+	SeverityError:   ConfigOnErrorKeyName,
+	SeverityFatal:   ConfigOnFatalKeyName,
+}
+
+// Action represents what the plugin does when a rule fails.
+//  A larger Action is stronger.
+type Action int
+
+const (
+	ActionLog   Action = iota // only logs the failure.
+	ActionRetry               // returns FLB_RETRY.
+	ActionError               // returns FLB_ERROR.
+	ActionExit                // exits the process.
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionLog:
+		return "log"
+	case ActionRetry:
+		return "retry"
+	case ActionError:
+		return "error"
+	case ActionExit:
+		return "exit"
+	}
+	return "unknown"
+}
+
+// ParseAction returns Action of s like "retry".
+func ParseAction(s string) (Action, error) {
+	switch strings.ToLower(s) {
+	case "log":
+		return ActionLog, nil
+	case "retry":
+		return ActionRetry, nil
+	case "error":
+		return ActionError, nil
+	case "exit":
+		return ActionExit, nil
+	}
+	return ActionLog, fmt.Errorf("unknown action:%q", s)
+}
+
+// Actions maps Severity to Action. The Action of a missing Severity is ActionLog.
+type Actions map[Severity]Action
+
+// Of returns the strongest Action of severities.
+func (a Actions) Of(severities ...Severity) Action {
+	ret := ActionLog
+	for _, s := range severities {
+		if act := a[s]; act > ret {
+			ret = act
+		}
+	}
+	return ret
+}
@@ -0,0 +1,113 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"testing"
+)
+
+func TestParseAction(t *testing.T) {
+	type testcase struct {
+		name   string
+		input  string
+		expect Action
+		isErr  bool
+	}
+
+	cases := []testcase{
+		{"log", "log", ActionLog, false},
+		{"retry", "retry", ActionRetry, false},
+		{"error", "Error", ActionError, false},
+		{"exit", "exit", ActionExit, false},
+		{"unknown", "abort", ActionLog, true},
+	}
+
+	for _, v := range cases {
+		ret, err := ParseAction(v.input)
+		if v.isErr {
+			if err == nil {
+				t.Errorf("%s: expect error", v.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: err:%s", v.name, err)
+		} else if ret != v.expect {
+			t.Errorf("%s: mismatch given:%s expect:%s", v.name, ret, v.expect)
+		}
+	}
+}
+
+func TestActionsOf(t *testing.T) {
+	actions := Actions{SeverityWarning: ActionRetry, SeverityError: ActionError, SeverityFatal: ActionExit}
+
+	type testcase struct {
+		name       string
+		severities []Severity
+		expect     Action
+	}
+
+	cases := []testcase{
+		{"none", nil, ActionLog},
+		{"info", []Severity{SeverityInfo}, ActionLog},
+		{"warn", []Severity{SeverityInfo, SeverityWarning}, ActionRetry},
+		{"strongest", []Severity{SeverityError, SeverityFatal, SeverityWarning}, ActionExit},
+	}
+
+	for _, v := range cases {
+		ret := actions.Of(v.severities...)
+		if ret != v.expect {
+			t.Errorf("%s: mismatch given:%s expect:%s", v.name, ret, v.expect)
+		}
+	}
+}
+
+func TestSeverityOfRule(t *testing.T) {
+	type testcase struct {
+		name   string
+		json   string
+		expect Severity
+		isErr  bool
+	}
+
+	cases := []testcase{
+		{"default", `{"key":"a"}`, SeverityError, false},
+		{"warn", `{"key":"a", "severity":"warn"}`, SeverityWarning, false},
+		{"fatal", `{"key":"a", "severity":"fatal"}`, SeverityFatal, false},
+		{"unknown", `{"key":"a", "severity":"critical"}`, SeverityError, true},
+	}
+
+	for _, v := range cases {
+		c, err := NewConfigLineFromJson(v.json)
+		if err != nil {
+			t.Fatalf("%s: NewConfigLineFromJson err:%s", v.name, err)
+		}
+		cnf := &Config{}
+		err = cnf.SetConfigLine(ConfigExistKeyName, c)
+		if v.isErr {
+			if err == nil {
+				t.Errorf("%s: expect error", v.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: err:%s", v.name, err)
+		} else if ret := cnf.existRules[0].metadata.Level(); ret != v.expect {
+			t.Errorf("%s: mismatch given:%s expect:%s", v.name, ret, v.expect)
+		}
+	}
+}
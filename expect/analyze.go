@@ -0,0 +1,338 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"fmt"
+	"go/types"
+	"math"
+	"strings"
+)
+
+// Severity represents the severity of Finding.
+type Severity int
+
+const (
+	SeverityInfo    Severity = iota // the rule is harmless but not needed.
+	SeverityWarning                 // the rule may be a mistake.
+	SeverityError                   // no record can match the rules.
+	SeverityFatal                   // only for rules. See Metadata.
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	case SeverityFatal:
+		return "fatal"
+	}
+	return "unknown"
+}
+
+// ParseSeverity returns Severity of s like "warn".
+func ParseSeverity(s string) (Severity, error) {
+	switch strings.ToLower(s) {
+	case "info":
+		return SeverityInfo, nil
+	case "warn", "warning":
+		return SeverityWarning, nil
+	case "error":
+		return SeverityError, nil
+	case "fatal":
+		return SeverityFatal, nil
+	}
+	return SeverityError, fmt.Errorf("unknown severity:%q", s)
+}
+
+// Finding represents a result of the static analysis of Config.
+type Finding struct {
+	Severity  Severity
+	Scope     string // RuleSet like "ruleset login" or "tag app.*". blank means top level.
+	Message   string
+	Params    []string // configuration names of the rules like "key_int0". It is blank if the rule has no ClParam.
+	Duplicate bool     // the rules are duplicated. Strict mode treats it as an error.
+}
+
+func (f Finding) String() string {
+	if f.Scope == "" {
+		return fmt.Sprintf("[%s] %s", f.Severity, f.Message)
+	}
+	return fmt.Sprintf("[%s] %s:%s", f.Severity, f.Scope, f.Message)
+}
+
+// scopedMessage returns the message with the scope.
+func (f Finding) scopedMessage() string {
+	if f.Scope == "" {
+		return f.Message
+	}
+	return f.Scope + ":" + f.Message
+}
+
+// Analyze finds conflicting and redundant rules of c.
+//  Rules are compared in the same Config. RuleSets of c are also analyzed.
+func (c Config) Analyze() []Finding {
+	return c.analyze("")
+}
+
+func (c Config) analyze(scope string) []Finding {
+	ret := []Finding{}
+	add := func(s Severity, params []string, format string, a ...interface{}) {
+		ret = append(ret, Finding{Severity: s, Scope: scope, Message: fmt.Sprintf(format, a...), Params: params})
+	}
+
+	for i, key := range c.Exists {
+		e := existRuleOf(c.existRules, i)
+		for j, vkey := range c.NotExists {
+			ne := existRuleOf(c.notExistRules, j)
+			if key.Compare(vkey) {
+				add(SeverityError, []string{e.param, ne.param}, "conflict key:%s", key.FlattenKeys)
+			} else if vkey.isPrefixOf(key) {
+				add(SeverityError, []string{e.param, ne.param}, "exists %s conflicts with not exists %s", key.FlattenKeys, vkey.FlattenKeys)
+			}
+		}
+	}
+	for i, vkey := range c.NotExists {
+		ne := existRuleOf(c.notExistRules, i)
+		for _, tc := range c.TypeConditions {
+			if vkey.Compare(tc.Keys) || vkey.isPrefixOf(tc.Keys) {
+				add(SeverityError, []string{ne.param, tc.param}, "%s conflicts with not exists %s", tc.TypeConditionStr, vkey.FlattenKeys)
+			}
+		}
+		for _, tc := range c.TimeConditions {
+			if vkey.Compare(tc.Keys) || vkey.isPrefixOf(tc.Keys) {
+				add(SeverityError, []string{ne.param, tc.param}, "%s conflicts with not exists %s", tc.TimeConditionStr, vkey.FlattenKeys)
+			}
+		}
+	}
+
+	for i, a := range c.TypeConditions {
+		for _, b := range c.TypeConditions[i+1:] {
+			if !a.Keys.Compare(b.Keys) {
+				continue
+			}
+			params := []string{a.param, b.param}
+			if a.matcher().Equal(b.matcher()) {
+				add(SeverityWarning, params, "%s is duplicated", b.TypeConditionStr)
+				ret[len(ret)-1].Duplicate = true
+				continue
+			}
+			if a.Matcher != nil || b.Matcher != nil || a.Condition.cref != "" || b.Condition.cref != "" {
+				continue
+			}
+			if valueFamily(a.Condition.ctype) != valueFamily(b.Condition.ctype) {
+				add(SeverityError, params, "contradictory types:%s and %s", a.TypeConditionStr, b.TypeConditionStr)
+				continue
+			}
+			if isContradictory(a.Condition, b.Condition) {
+				add(SeverityError, params, "contradictory conditions:%s and %s", a.TypeConditionStr, b.TypeConditionStr)
+			} else if implies(a.Condition, b.Condition) {
+				add(SeverityWarning, params, "%s is redundant by %s", b.TypeConditionStr, a.TypeConditionStr)
+			} else if implies(b.Condition, a.Condition) {
+				add(SeverityWarning, params, "%s is redundant by %s", a.TypeConditionStr, b.TypeConditionStr)
+			}
+		}
+	}
+
+	// a condition requires its key.
+	for i, key := range c.Exists {
+		e := existRuleOf(c.existRules, i)
+		for _, tc := range c.TypeConditions {
+			if key.Compare(tc.Keys) || key.isPrefixOf(tc.Keys) {
+				add(SeverityInfo, []string{e.param, tc.param}, "exists %s is redundant by %s", key.FlattenKeys, tc.TypeConditionStr)
+				break
+			}
+		}
+	}
+
+	for _, rs := range c.RuleSets {
+		s := "ruleset " + rs.Name
+		if rs.Name == "" && rs.Tag != nil {
+			s = "tag " + rs.Tag.String()
+		}
+		if scope != "" {
+			s = scope + ":" + s
+		}
+		ret = append(ret, rs.Config.analyze(s)...)
+	}
+	return ret
+}
+
+// isPrefixOf check if k is a parent of ks like "a" and "a"->"b".
+func (k Keys) isPrefixOf(ks Keys) bool {
+	if len(k.Keys) == 0 || len(k.Keys) >= len(ks.Keys) || k.pseudo || ks.pseudo {
+		return false
+	}
+	for i, key := range k.Keys {
+		if ks.Keys[i] != key {
+			return false
+		}
+	}
+	return true
+}
+
+// valueFamily returns the kind of values which t can match.
+//  Int and Uint conditions match the same integer values.
+func valueFamily(t types.BasicKind) types.BasicKind {
+	if t == types.Uint {
+		return types.Int
+	}
+	return t
+}
+
+// interval represents a range of numbers.
+type interval struct {
+	lo, hi         float64
+	loOpen, hiOpen bool
+}
+
+// numberInterval returns the interval which c matches.
+//  It returns false if c is not numeric or c is CaseNe.
+func numberInterval(c Condition) (interval, bool) {
+	var v float64
+	switch n := c.cvalue.(type) {
+	case int:
+		v = float64(n)
+	case uint:
+		v = float64(n)
+	case float64:
+		v = n
+	default:
+		return interval{}, false
+	}
+	inf := math.Inf(1)
+	switch c.ccase {
+	case CaseGt:
+		return interval{lo: v, hi: inf, loOpen: true, hiOpen: true}, true
+	case CaseGe:
+		return interval{lo: v, hi: inf, hiOpen: true}, true
+	case CaseLt:
+		return interval{lo: -inf, hi: v, loOpen: true, hiOpen: true}, true
+	case CaseLe:
+		return interval{lo: -inf, hi: v, loOpen: true}, true
+	case CaseEq:
+		return interval{lo: v, hi: v}, true
+	}
+	return interval{}, false
+}
+
+// contains check if v is in i.
+func (i interval) contains(v float64) bool {
+	if v < i.lo || (v == i.lo && i.loOpen) {
+		return false
+	}
+	return v < i.hi || (v == i.hi && !i.hiOpen)
+}
+
+// isEmptyWith check if no number is in both i and j.
+func (i interval) isEmptyWith(j interval) bool {
+	lo, loOpen := i.lo, i.loOpen
+	if j.lo > lo || (j.lo == lo && j.loOpen) {
+		lo, loOpen = j.lo, j.loOpen
+	}
+	hi, hiOpen := i.hi, i.hiOpen
+	if j.hi < hi || (j.hi == hi && j.hiOpen) {
+		hi, hiOpen = j.hi, j.hiOpen
+	}
+	return lo > hi || (lo == hi && (loOpen || hiOpen))
+}
+
+// isSubsetOf check if all numbers of i are in j.
+func (i interval) isSubsetOf(j interval) bool {
+	lo := i.lo > j.lo || (i.lo == j.lo && (i.loOpen || !j.loOpen))
+	hi := i.hi < j.hi || (i.hi == j.hi && (i.hiOpen || !j.hiOpen))
+	return lo && hi
+}
+
+// numberValue returns the value of numeric c as float64.
+func numberValue(c Condition) (float64, bool) {
+	i, ok := numberInterval(Condition{ctype: c.ctype, ccase: CaseEq, cvalue: c.cvalue})
+	return i.lo, ok
+}
+
+// isContradictory check if no value matches both a and b.
+//  a and b must have the same value family and no pseudo-field.
+func isContradictory(a, b Condition) bool {
+	switch valueFamily(a.ctype) {
+	case types.Bool:
+		av, bv := a.cvalue.(bool), b.cvalue.(bool)
+		return (a.ccase == b.ccase) != (av == bv)
+	case types.String:
+		if a.ccase != CaseEq && (b.ccase == CaseEq || b.ccase == CaseContains) {
+			a, b = b, a
+		}
+		switch a.ccase {
+		case CaseEq:
+			// a value which matches a is only a.cvalue.
+			return !b.matchString(a.cvalue.(string))
+		case CaseContains:
+			return b.ccase == CaseNotContains && strings.Contains(a.cvalue.(string), b.cvalue.(string))
+		}
+		return false
+	}
+
+	if b.ccase == CaseNe {
+		a, b = b, a
+	}
+	if a.ccase == CaseNe {
+		v, ok := numberValue(a)
+		bi, ok2 := numberInterval(b)
+		return ok && ok2 && bi.lo == v && bi.hi == v
+	}
+	ai, ok := numberInterval(a)
+	bi, ok2 := numberInterval(b)
+	return ok && ok2 && ai.isEmptyWith(bi)
+}
+
+// implies check if all values which match a also match b.
+//  a and b must have the same value family and no pseudo-field.
+func implies(a, b Condition) bool {
+	switch valueFamily(a.ctype) {
+	case types.Bool:
+		// Eq true and Ne false are same.
+		return true
+	case types.String:
+		av, bv := a.cvalue.(string), b.cvalue.(string)
+		switch a.ccase {
+		case CaseEq:
+			return b.matchString(av)
+		case CaseContains:
+			return (b.ccase == CaseContains && strings.Contains(av, bv)) ||
+				(b.ccase == CaseNe && !strings.Contains(bv, av))
+		case CaseNotContains:
+			return (b.ccase == CaseNotContains || b.ccase == CaseNe) && strings.Contains(bv, av)
+		}
+		return false
+	}
+
+	if a.ccase == CaseNe {
+		return false
+	}
+	ai, ok := numberInterval(a)
+	if !ok {
+		return false
+	}
+	if b.ccase == CaseNe {
+		v, ok := numberValue(b)
+		return ok && !ai.contains(v)
+	}
+	bi, ok := numberInterval(b)
+	return ok && ai.isSubsetOf(bi)
+}
@@ -0,0 +1,210 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testRule struct {
+	name string
+	json string
+}
+
+func newTestConfig(t *testing.T, rules []testRule) *Config {
+	t.Helper()
+	cnf := &Config{}
+	for i, v := range rules {
+		cnfl, err := NewConfigLineFromJson(v.json)
+		if err != nil {
+			t.Fatalf("%d:NewConfigLine err:%s", i, err)
+		}
+		err = cnf.SetConfigLine(v.name, cnfl)
+		if err != nil {
+			t.Fatalf("%d:SetConfigLine err:%s", i, err)
+		}
+	}
+	return cnf
+}
+
+func TestAnalyze(t *testing.T) {
+	type testcase struct {
+		name   string
+		rules  []testRule
+		expect []string
+	}
+
+	cases := []testcase{
+		{"numeric",
+			[]testRule{
+				{ConfigIntKeyName, `{"key":"a", "condition":">", "value":10}`},
+				{ConfigIntKeyName, `{"key":"a", "condition":"<", "value":5}`},
+			},
+			[]string{`[error] contradictory conditions:"a" > 10 and "a" < 5`},
+		},
+		{"numeric boundary",
+			[]testRule{
+				{ConfigDoubleKeyName, `{"key":"a", "condition":">=", "value":1.5}`},
+				{ConfigDoubleKeyName, `{"key":"a", "condition":"<", "value":1.5}`},
+				{ConfigIntKeyName, `{"key":"b", "condition":">=", "value":1}`},
+				{ConfigUintKeyName, `{"key":"b", "condition":"<=", "value":1}`},
+			},
+			[]string{`[error] contradictory conditions:"a" >= 1.5 and "a" < 1.5`},
+		},
+		{"not equal",
+			[]testRule{
+				{ConfigIntKeyName, `{"key":"a", "condition":"==", "value":1}`},
+				{ConfigIntKeyName, `{"key":"a", "condition":"!=", "value":1}`},
+			},
+			[]string{`[error] contradictory conditions:"a" == 1 and "a" != 1`},
+		},
+		{"type",
+			[]testRule{
+				{ConfigIntKeyName, `{"key":"a", "condition":"==", "value":1}`},
+				{ConfigStrKeyName, `{"key":"a", "condition":"==", "value":"1"}`},
+			},
+			[]string{`[error] contradictory types:"a" == 1 and "a" == 1`},
+		},
+		{"string",
+			[]testRule{
+				{ConfigStrKeyName, `{"key":"a", "condition":"==", "value":"a"}`},
+				{ConfigStrKeyName, `{"key":"a", "condition":"==", "value":"b"}`},
+				{ConfigStrKeyName, `{"key":"b", "condition":"contains", "value":"abc"}`},
+				{ConfigStrKeyName, `{"key":"b", "condition":"not_contains", "value":"b"}`},
+			},
+			[]string{
+				`[error] contradictory conditions:"a" == a and "a" == b`,
+				`[error] contradictory conditions:"b" contains abc and "b" not_contains b`,
+			},
+		},
+		{"bool",
+			[]testRule{
+				{ConfigBoolKeyName, `{"key":"a", "condition":"==", "value":true}`},
+				{ConfigBoolKeyName, `{"key":"a", "condition":"!=", "value":true}`},
+			},
+			[]string{`[error] contradictory conditions:"a" == true and "a" != true`},
+		},
+		{"redundant",
+			[]testRule{
+				{ConfigIntKeyName, `{"key":"a", "condition":">", "value":10}`},
+				{ConfigIntKeyName, `{"key":"a", "condition":">", "value":5}`},
+				{ConfigIntKeyName, `{"key":"a", "condition":"!=", "value":3}`},
+				{ConfigStrKeyName, `{"key":"b", "condition":"==", "value":"abc"}`},
+				{ConfigStrKeyName, `{"key":"b", "condition":"contains", "value":"b"}`},
+				{ConfigExistKeyName, `{"key":"b"}`},
+			},
+			[]string{
+				`[warning] "a" > 5 is redundant by "a" > 10`,
+				`[warning] "a" != 3 is redundant by "a" > 10`,
+				`[warning] "a" != 3 is redundant by "a" > 5`,
+				`[warning] "b" contains b is redundant by "b" == abc`,
+				`[info] exists "b" is redundant by "b" == abc`,
+			},
+		},
+		{"not exists",
+			[]testRule{
+				{ConfigNotExistKeyName, `{"key":"a"}`},
+				{ConfigIntKeyName, `{"key":["a","b"], "condition":">", "value":10}`},
+				{ConfigExistKeyName, `{"key":["a","c"]}`},
+				{ConfigTimeKeyName, `{"key":"a", "condition":"<", "value":"now"}`},
+			},
+			[]string{
+				`[error] exists "a"->"c" conflicts with not exists "a"`,
+				`[error] "a"->"b" > 10 conflicts with not exists "a"`,
+				`[error] "a" < now+0s conflicts with not exists "a"`,
+			},
+		},
+		{"ruleset",
+			[]testRule{
+				{ConfigIntKeyName, `{"key":"a", "condition":">", "value":10, "ruleset":"r"}`},
+				{ConfigIntKeyName, `{"key":"a", "condition":"<", "value":5, "ruleset":"r"}`},
+				{ConfigIntKeyName, `{"key":"a", "condition":"<", "value":5}`},
+			},
+			[]string{`[error] ruleset r:contradictory conditions:"a" > 10 and "a" < 5`},
+		},
+		{"duplicated",
+			[]testRule{
+				{ConfigIntKeyName, `{"key":"a", "condition":">", "value":1}`},
+				{ConfigIntKeyName, `{"key": "a", "condition":">", "value":1}`},
+			},
+			[]string{`[warning] "a" > 1 is duplicated`},
+		},
+		{"no finding",
+			[]testRule{
+				{ConfigIntKeyName, `{"key":"a", "condition":">", "value":1}`},
+				{ConfigIntKeyName, `{"key":"a", "condition":"<", "value":5}`},
+				{ConfigStrKeyName, `{"key":"b", "condition":"==", "value":"$TAG"}`},
+				{ConfigStrKeyName, `{"key":"b", "condition":"==", "value":"x"}`},
+			},
+			[]string{},
+		},
+	}
+
+	for _, v := range cases {
+		cnf := newTestConfig(t, v.rules)
+		ret := cnf.Analyze()
+		if len(ret) != len(v.expect) {
+			t.Errorf("%s: length mismatch:\n given :%v\n expect:%v", v.name, ret, v.expect)
+			continue
+		}
+		for i, f := range ret {
+			if f.String() != v.expect[i] {
+				t.Errorf("%s %d: mismatch:\n given :%s\n expect:%s", v.name, i, f, v.expect[i])
+			}
+			if dup := strings.HasSuffix(v.expect[i], " is duplicated"); f.Duplicate != dup {
+				t.Errorf("%s %d: Duplicate mismatch given:%t expect:%t", v.name, i, f.Duplicate, dup)
+			}
+		}
+	}
+}
+
+func TestAnalyzeParams(t *testing.T) {
+	rules := []testRule{
+		{ConfigExistKeyName, `{"key":"a"}`},
+		{ConfigIntKeyName, `{"key":"b", "condition":">", "value":10, "ruleset":"r"}`},
+		{ConfigNotExistKeyName, `{"key":"a"}`},
+		{ConfigIntKeyName, `{"key":"b", "condition":"<", "value":5, "ruleset":"r"}`},
+	}
+	cnf := &Config{}
+	for i, v := range rules {
+		cnfl, err := NewConfigLineFromJson(v.json)
+		if err != nil {
+			t.Fatalf("%d:NewConfigLine err:%s", i, err)
+		}
+		cnfl.ClParam = fmt.Sprintf("%s%d", v.name, i)
+		if err := cnf.SetConfigLine(v.name, cnfl); err != nil {
+			t.Fatalf("%d:SetConfigLine err:%s", i, err)
+		}
+	}
+
+	expect := [][]string{
+		{"key_exists0", "key_not_exists2"},
+		{"key_int1", "key_int3"},
+	}
+	ret := cnf.Analyze()
+	if len(ret) != len(expect) {
+		t.Fatalf("length mismatch:%v", ret)
+	}
+	for i, f := range ret {
+		if !reflect.DeepEqual(f.Params, expect[i]) {
+			t.Errorf("%d: mismatch:\n given :%v\n expect:%v", i, f.Params, expect[i])
+		}
+	}
+}
@@ -0,0 +1,401 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RuleBuilder builds rules of a key in Go. e.g.
+//    expect.Key("http", "status").Int().Between(200, 299).ID("status-ok")
+//  Options like ID and Tag are applied to all rules of the builder.
+//  An error is reported by Lines or Build.
+type RuleBuilder struct {
+	key   []interface{}
+	typ   string
+	lines []ConfigLine
+	opts  ConfigLine // options which are set to all lines.
+	err   error
+}
+
+// Key returns RuleBuilder of the key path like Key("kubernetes", "labels", "app").
+func Key(keys ...string) *RuleBuilder {
+	b := &RuleBuilder{}
+	if len(keys) == 0 {
+		b.err = errors.New("blank key")
+	}
+	b.key = toInterfaces(keys)
+	return b
+}
+
+// Timestamp returns RuleBuilder of the timestamp of records. See event_time.
+func Timestamp() *RuleBuilder {
+	return &RuleBuilder{typ: "event_time"}
+}
+
+// DefineRuleSet returns RuleBuilder which defines the named RuleSet.
+//  Rules of the RuleSet are added by InRuleSet.
+func DefineRuleSet(name string) *RuleBuilder {
+	b := &RuleBuilder{typ: "ruleset"}
+	b.lines = append(b.lines, ConfigLine{ClType: b.typ, ClName: name})
+	return b
+}
+
+func (b *RuleBuilder) setType(typ string) *RuleBuilder {
+	if b.key == nil && b.err == nil {
+		b.err = fmt.Errorf("%s needs Key", typ)
+	}
+	b.typ = typ
+	return b
+}
+
+// Exists adds the rule that the key exists.
+func (b *RuleBuilder) Exists() *RuleBuilder {
+	b.setType("exists")
+	b.lines = append(b.lines, ConfigLine{ClType: b.typ, ClKey: b.key})
+	return b
+}
+
+// NotExists adds the rule that the key doesn't exist.
+func (b *RuleBuilder) NotExists() *RuleBuilder {
+	b.setType("not_exists")
+	b.lines = append(b.lines, ConfigLine{ClType: b.typ, ClKey: b.key})
+	return b
+}
+
+// Bool sets the type of the following conditions to bool.
+func (b *RuleBuilder) Bool() *RuleBuilder {
+	return b.setType("bool")
+}
+
+// Str sets the type of the following conditions to string.
+func (b *RuleBuilder) Str() *RuleBuilder {
+	return b.setType("str")
+}
+
+// Int sets the type of the following conditions to int.
+func (b *RuleBuilder) Int() *RuleBuilder {
+	return b.setType("int")
+}
+
+// Uint sets the type of the following conditions to uint.
+func (b *RuleBuilder) Uint() *RuleBuilder {
+	return b.setType("uint")
+}
+
+// Double sets the type of the following conditions to double.
+func (b *RuleBuilder) Double() *RuleBuilder {
+	return b.setType("double")
+}
+
+// Time sets the type of the following conditions to time.
+func (b *RuleBuilder) Time() *RuleBuilder {
+	return b.setType("time")
+}
+
+// Family sets the type of the following conditions to the rule family registered by RegisterMatcher.
+func (b *RuleBuilder) Family(name string) *RuleBuilder {
+	return b.setType(name)
+}
+
+// Condition adds the rule of the condition like ">=" and the value.
+func (b *RuleBuilder) Condition(cond string, v interface{}) *RuleBuilder {
+	if b.typ == "" || b.typ == "exists" || b.typ == "not_exists" || b.typ == "ruleset" {
+		if b.err == nil {
+			b.err = fmt.Errorf("condition %s needs a type like Int", cond)
+		}
+		return b
+	}
+	typ := b.typ
+	if cond == "format" || cond == "not_format" {
+		typ = "format"
+	}
+	line := ConfigLine{ClType: typ, ClCondition: cond, ClValue: builderValue(typ, v)}
+	if typ != "event_time" {
+		line.ClKey = b.key
+	}
+	b.lines = append(b.lines, line)
+	return b
+}
+
+// builderValue converts v to the value of Json.
+//  An integer of int and uint rules is json.Number to keep the precision. Other integers are float64.
+func builderValue(typ string, v interface{}) interface{} {
+	if typ == "int" || typ == "uint" {
+		switch n := v.(type) {
+		case int, int8, int16, int32, int64:
+			return json.Number(fmt.Sprintf("%d", n))
+		case uint, uint8, uint16, uint32, uint64:
+			return json.Number(fmt.Sprintf("%d", n))
+		}
+	}
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int8:
+		return float64(n)
+	case int16:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case uint:
+		return float64(n)
+	case uint8:
+		return float64(n)
+	case uint16:
+		return float64(n)
+	case uint32:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	case float32:
+		return float64(n)
+	case time.Time:
+		return n.Format(time.RFC3339Nano)
+	case time.Duration:
+		return n.String()
+	}
+	return v
+}
+
+// Eq adds the condition "==".
+func (b *RuleBuilder) Eq(v interface{}) *RuleBuilder { return b.Condition("==", v) }
+
+// Ne adds the condition "!=".
+func (b *RuleBuilder) Ne(v interface{}) *RuleBuilder { return b.Condition("!=", v) }
+
+// Gt adds the condition ">".
+func (b *RuleBuilder) Gt(v interface{}) *RuleBuilder { return b.Condition(">", v) }
+
+// Ge adds the condition ">=".
+func (b *RuleBuilder) Ge(v interface{}) *RuleBuilder { return b.Condition(">=", v) }
+
+// Lt adds the condition "<".
+func (b *RuleBuilder) Lt(v interface{}) *RuleBuilder { return b.Condition("<", v) }
+
+// Le adds the condition "<=".
+func (b *RuleBuilder) Le(v interface{}) *RuleBuilder { return b.Condition("<=", v) }
+
+// Between adds the conditions ">=" lo and "<=" hi.
+func (b *RuleBuilder) Between(lo, hi interface{}) *RuleBuilder { return b.Ge(lo).Le(hi) }
+
+// Contains adds the condition "contains".
+func (b *RuleBuilder) Contains(s string) *RuleBuilder {
+	return b.Condition("contains", s)
+}
+
+// NotContains adds the condition "not_contains".
+func (b *RuleBuilder) NotContains(s string) *RuleBuilder {
+	return b.Condition("not_contains", s)
+}
+
+// Regex adds the condition "regex".
+func (b *RuleBuilder) Regex(re string) *RuleBuilder {
+	return b.Condition("regex", re)
+}
+
+// NotRegex adds the condition "not_regex".
+func (b *RuleBuilder) NotRegex(re string) *RuleBuilder {
+	return b.Condition("not_regex", re)
+}
+
+// Format adds the condition "format" like "uuid". See Format.
+func (b *RuleBuilder) Format(name string) *RuleBuilder {
+	return b.Condition("format", name)
+}
+
+// NotFormat adds the condition "not_format".
+func (b *RuleBuilder) NotFormat(name string) *RuleBuilder {
+	return b.Condition("not_format", name)
+}
+
+// NotZero adds the condition "not_zero" of Timestamp.
+func (b *RuleBuilder) NotZero() *RuleBuilder {
+	return b.Condition("not_zero", nil)
+}
+
+// Subsecond adds the condition "subsecond" of Timestamp.
+func (b *RuleBuilder) Subsecond() *RuleBuilder {
+	return b.Condition("subsecond", nil)
+}
+
+// Near adds the condition "near" of Timestamp. The time field of keys should be within tolerance.
+func (b *RuleBuilder) Near(tolerance time.Duration, keys ...string) *RuleBuilder {
+	b.Condition("near", tolerance)
+	if len(b.lines) > 0 && b.typ == "event_time" {
+		b.lines[len(b.lines)-1].ClKey = toInterfaces(keys)
+	}
+	return b
+}
+
+// When adds rules which select records of the RuleSet defined by DefineRuleSet.
+func (b *RuleBuilder) When(rules ...*RuleBuilder) *RuleBuilder {
+	if b.typ != "ruleset" {
+		if b.err == nil {
+			b.err = errors.New("When needs DefineRuleSet")
+		}
+		return b
+	}
+	for _, r := range rules {
+		lines, err := r.Lines()
+		if err != nil {
+			if b.err == nil {
+				b.err = fmt.Errorf("when:%w", err)
+			}
+			return b
+		}
+		b.lines[0].ClWhen = append(b.lines[0].ClWhen, lines...)
+	}
+	return b
+}
+
+// ID sets "id" of the rules.
+func (b *RuleBuilder) ID(id string) *RuleBuilder {
+	b.opts.ClID = id
+	return b
+}
+
+// Description sets "description" of the rules.
+func (b *RuleBuilder) Description(s string) *RuleBuilder {
+	b.opts.ClDescription = s
+	return b
+}
+
+// Owner sets "owner" of the rules.
+func (b *RuleBuilder) Owner(s string) *RuleBuilder {
+	b.opts.ClOwner = s
+	return b
+}
+
+// RunbookURL sets "runbook_url" of the rules.
+func (b *RuleBuilder) RunbookURL(s string) *RuleBuilder {
+	b.opts.ClRunbookURL = s
+	return b
+}
+
+// Label adds the label of the rules.
+func (b *RuleBuilder) Label(name, value string) *RuleBuilder {
+	if b.opts.ClLabels == nil {
+		b.opts.ClLabels = map[string]string{}
+	}
+	b.opts.ClLabels[name] = value
+	return b
+}
+
+// Severity sets "severity" of the rules.
+func (b *RuleBuilder) Severity(s Severity) *RuleBuilder {
+	switch s {
+	case SeverityWarning:
+		b.opts.ClSeverity = "warn"
+	default:
+		b.opts.ClSeverity = s.String()
+	}
+	return b
+}
+
+// Tag sets the tag pattern of the rules.
+func (b *RuleBuilder) Tag(pattern string) *RuleBuilder {
+	b.opts.ClTag = pattern
+	return b
+}
+
+// InRuleSet sets the named RuleSet which the rules belong to.
+func (b *RuleBuilder) InRuleSet(name string) *RuleBuilder {
+	b.opts.ClRuleSet = name
+	return b
+}
+
+// Layout sets the layout of time.
+func (b *RuleBuilder) Layout(layout string) *RuleBuilder {
+	b.opts.ClLayout = layout
+	return b
+}
+
+// Timezone sets the timezone of time like "Asia/Tokyo".
+func (b *RuleBuilder) Timezone(tz string) *RuleBuilder {
+	b.opts.ClTimezone = tz
+	return b
+}
+
+// Lines returns ConfigLines of b. Each ConfigLine has "type".
+func (b *RuleBuilder) Lines() ([]ConfigLine, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.lines) == 0 {
+		return nil, errors.New("no rule")
+	}
+	ret := make([]ConfigLine, len(b.lines))
+	for i, line := range b.lines {
+		if line.ClTag == "" {
+			line.ClTag = b.opts.ClTag
+		}
+		if line.ClRuleSet == "" && line.ClType != "ruleset" {
+			line.ClRuleSet = b.opts.ClRuleSet
+		}
+		if line.ClLayout == "" {
+			line.ClLayout = b.opts.ClLayout
+		}
+		if line.ClTimezone == "" {
+			line.ClTimezone = b.opts.ClTimezone
+		}
+		line.setMetadata(b.opts.metadata())
+		ret[i] = line
+	}
+	return ret, nil
+}
+
+// AddRules sets rules of builders to cnf.
+func (cnf *Config) AddRules(rules ...*RuleBuilder) error {
+	for i, r := range rules {
+		lines, err := r.Lines()
+		if err != nil {
+			return fmt.Errorf("rules[%d]:%w", i, err)
+		}
+		for j := range lines {
+			name, err := lines[j].RuleName()
+			if err != nil {
+				return fmt.Errorf("rules[%d]:%w", i, err)
+			}
+			if err := cnf.SetConfigLine(name, &lines[j]); err != nil {
+				return fmt.Errorf("rules[%d]:%w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Build returns Config of rules. The Config is validated by Validate and UndefinedRuleSets.
+func Build(rules ...*RuleBuilder) (*Config, error) {
+	cnf := &Config{}
+	if err := cnf.AddRules(rules...); err != nil {
+		return nil, err
+	}
+	if err := cnf.Validate(); err != nil {
+		return nil, err
+	}
+	if names := cnf.UndefinedRuleSets(); len(names) > 0 {
+		return nil, errors.New("undefined rule set:" + strings.Join(names, ","))
+	}
+	return cnf, nil
+}
@@ -0,0 +1,125 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuild(t *testing.T) {
+	cnf, err := Build(
+		Key("http", "status").Int().Between(200, 299).ID("status-ok").Owner("team-web").Severity(SeverityWarning),
+		Key("log").Exists(),
+		Key("debug").NotExists().Tag("app.*"),
+		Key("user", "email").Str().Regex(".+@.+").Label("pii", "true"),
+		Key("id").Str().Format("uuid"),
+		Key("time").Time().Gt(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)).Layout("2006-01-02T15:04:05Z07:00"),
+		Timestamp().NotZero(),
+		DefineRuleSet("login").When(Key("event").Str().Eq("login")).Owner("team-auth"),
+		Key("user").Exists().InRuleSet("login"),
+	)
+	if err != nil {
+		t.Fatalf("Build err:%s", err)
+	}
+
+	expect := []string{
+		`"http"->"status" >= 200`,
+		`"http"->"status" <= 299`,
+		`"user"->"email" regex .+@.+`,
+		`"id" format uuid`,
+	}
+	if len(cnf.TypeConditions) != len(expect) {
+		t.Fatalf("length mismatch:%+v", cnf.TypeConditions)
+	}
+	for i, v := range cnf.TypeConditions {
+		if v.TypeConditionStr != expect[i] {
+			t.Errorf("%d mismatch:\n given :%s\n expect:%s", i, v.TypeConditionStr, expect[i])
+		}
+	}
+	m := &Metadata{ID: "status-ok", Owner: "team-web", Severity: "warn"}
+	if !reflect.DeepEqual(cnf.TypeConditions[1].Metadata, m) {
+		t.Errorf("metadata mismatch:%+v", cnf.TypeConditions[1].Metadata)
+	}
+	if len(cnf.Exists) != 1 || len(cnf.TimeConditions) != 1 || len(cnf.EventTimeConditions) != 1 {
+		t.Errorf("rules mismatch:%+v", cnf)
+	}
+	if len(cnf.RuleSets) != 2 {
+		t.Fatalf("rule sets mismatch:%+v", cnf.RuleSets)
+	}
+	if rs := cnf.RuleSets[1]; rs.Name != "login" || rs.When == nil || len(rs.Exists) != 1 || rs.Metadata.Owner != "team-auth" {
+		t.Errorf("login mismatch:%+v", rs)
+	}
+}
+
+func TestBuildIntPrecision(t *testing.T) {
+	cnf, err := Build(
+		Key("i").Int().Eq(int64(math.MaxInt64)),
+		Key("u").Uint().Eq(uint64(math.MaxUint64)),
+		Key("n").Int().Eq(int64(1<<53+1)),
+	)
+	if err != nil {
+		t.Fatalf("Build err:%s", err)
+	}
+
+	type testcase struct {
+		name   string
+		i      int64
+		u      uint64
+		n      int64
+		expect bool
+	}
+	cases := []testcase{
+		{"match", math.MaxInt64, math.MaxUint64, 1<<53 + 1, true},
+		{"MaxInt64-1", math.MaxInt64 - 1, math.MaxUint64, 1<<53 + 1, false},
+		{"MaxUint64-1", math.MaxInt64, math.MaxUint64 - 1, 1<<53 + 1, false},
+		{"2^53", math.MaxInt64, math.MaxUint64, 1 << 53, false},
+	}
+	for _, v := range cases {
+		r := &Record{Map: map[interface{}]interface{}{"i": v.i, "u": v.u, "n": v.n}}
+		if ret := cnf.IsMatch(r, time.Now()); ret != v.expect {
+			t.Errorf("%s: mismatch given:%t expect:%t", v.name, ret, v.expect)
+		}
+	}
+}
+
+func TestBuildError(t *testing.T) {
+	type testcase struct {
+		name  string
+		rules []*RuleBuilder
+	}
+
+	cases := []testcase{
+		{"blank key", []*RuleBuilder{Key().Exists()}},
+		{"no type", []*RuleBuilder{Key("a").Eq(1)}},
+		{"no rule", []*RuleBuilder{Key("a").Int()}},
+		{"invalid condition", []*RuleBuilder{Key("a").Str().Gt("b")}},
+		{"invalid value", []*RuleBuilder{Key("a").Int().Eq("b")}},
+		{"contradiction", []*RuleBuilder{Key("a").Int().Gt(10).Lt(5)}},
+		{"undefined rule set", []*RuleBuilder{Key("a").Exists().InRuleSet("login")}},
+		{"when without rule set", []*RuleBuilder{Key("a").Exists().When(Key("b").Exists())}},
+		{"invalid when", []*RuleBuilder{DefineRuleSet("login").When(Key("b").Int())}},
+	}
+
+	for _, v := range cases {
+		if _, err := Build(v.rules...); err == nil {
+			t.Errorf("%s: expect error", v.name)
+		}
+	}
+}
@@ -19,48 +19,266 @@ package expect
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"go/types"
+	"strings"
+	"time"
 )
 
+// Deprecated: The index of parameters is not limited to ParamNumMax. See DefaultMaxIndex.
 const ParamNumMax = 16
 const ConfigExistKeyName = "key_exists"
 const ConfigNotExistKeyName = "key_not_exists"
+const ConfigStrictKeyName = "strict"
 
 // Config represents context of this plugin.
+//  It can be marshaled to Json and unmarshaled again. See MarshalJSON of each rule.
 type Config struct {
-	Exists         []Keys
-	NotExists      []Keys
-	TypeConditions []TypeCondition
+	Exists         []Keys             `json:"exists,omitempty"`
+	NotExists      []Keys             `json:"not_exists,omitempty"`
+	TypeConditions []TypeCondition    `json:"type_conditions,omitempty"`
+	TimeConditions []KeyTimeCondition `json:"time_conditions,omitempty"`
+
+	existRules    []existRule // metadata of Exists by index.
+	notExistRules []existRule // metadata of NotExists by index.
+
+	EventTimeConditions []EventTimeCondition `json:"event_time_conditions,omitempty"`
+
+	RuleSets           []RuleSet `json:"rulesets,omitempty"`
+	ReportUnclassified bool      `json:"report_unclassified,omitempty"` // report a record which is selected by no named RuleSet.
+
+	Definitions *Definitions `json:"definitions,omitempty"` // aliases and templates which rules can use.
+}
+
+// ConfigRuleNames is the list of built-in rule names. See RuleNames for the registered rule families.
+//  Each configuration name is the rule name with index like "key_exists0".
+var ConfigRuleNames = []string{
+	ConfigRuleSetKeyName,
+	ConfigExistKeyName,
+	ConfigNotExistKeyName,
+	ConfigBoolKeyName,
+	ConfigStrKeyName,
+	ConfigIntKeyName,
+	ConfigUintKeyName,
+	ConfigDoubleKeyName,
+	ConfigFormatKeyName,
+	ConfigTimeKeyName,
+	ConfigEventTimeKeyName,
+	ConfigUseKeyName,
 }
 
 // Validate check if configuration value is ok or not.
+//  It returns the first Finding of SeverityError. See Analyze.
 func (c Config) Validate() error {
-	for _, key := range c.Exists {
-		for _, vkey := range c.NotExists {
-			if key.Compare(vkey) {
-				return errors.New("conflict key")
-			}
+	for _, f := range c.Analyze() {
+		if f.Severity == SeverityError {
+			return errors.New(f.scopedMessage())
 		}
 	}
 	return nil
 }
 
+// IsMatch check if r matches all rules of cnf.
+//  RuleSets of cnf are checked if r is selected. It is same as no failure of Evaluator.
+func (cnf *Config) IsMatch(r *Record, now time.Time) bool {
+	ev := NewEvaluator(cnf)
+	ev.Now = func() time.Time {
+		return now
+	}
+	return len(ev.EvaluateRecord(r)) == 0
+}
+
 // ConfigLine represents each line of config file.
 type ConfigLine struct {
-	ClKey       interface{} `json:"key"` // string or []string
-	ClValue     interface{} `json:"value,omitempty"`
-	ClCondition string      `json:"condition,omitempty"`
+	ClKey       interface{}  `json:"key"` // string or []string
+	ClValue     interface{}  `json:"value,omitempty"`
+	ClCondition string       `json:"condition,omitempty"`
+	ClLayout    string       `json:"layout,omitempty"`   // for key_time and event_time
+	ClTimezone  string       `json:"timezone,omitempty"` // for key_time and event_time
+	ClTag       string       `json:"tag,omitempty"`      // the rule is applied only to this tag pattern
+	ClRuleSet   string       `json:"ruleset,omitempty"`  // the rule belongs to this named rule set
+	ClType      string       `json:"type,omitempty"`     // rule type like "int". It is used by "when" and RuleDocument.
+	ClName      string       `json:"name,omitempty"`     // for ruleset
+	ClWhen      []ConfigLine `json:"when,omitempty"`     // for ruleset
+	ClTemplate  string       `json:"template,omitempty"` // for use
+	ClAt        interface{}  `json:"at,omitempty"`       // for use
+
+	ClID          string            `json:"id,omitempty"` // metadata which is reported with the failure. See Metadata.
+	ClDescription string            `json:"description,omitempty"`
+	ClOwner       string            `json:"owner,omitempty"`
+	ClLabels      map[string]string `json:"labels,omitempty"`
+	ClRunbookURL  string            `json:"runbook_url,omitempty"`
+	ClSeverity    string            `json:"severity,omitempty"`
+
+	ClParam string `json:"-"` // configuration name which the rule is read from like "key_int0". See Finding.
+}
+
+// RuleNameOfType returns the rule name of type t.
+//  e.g. "int" -> "key_int", "event_time" -> "event_time"
+//  The rule families registered by RegisterMatcher are also looked up.
+func RuleNameOfType(t string) (string, error) {
+	if name, ok := builtinRuleName(t); ok {
+		return name, nil
+	}
+	if isMatcherFamily(t) {
+		return "key_" + t, nil
+	}
+	if _, ok := lookupMatcher(t); ok {
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown type:%q", t)
+}
+
+func builtinRuleName(t string) (string, bool) {
+	for _, name := range ConfigRuleNames {
+		if name == t || name == "key_"+t {
+			return name, true
+		}
+	}
+	return "", false
 }
 
 // NewConfigLineFromJson returns ConfigLine pointer via Json s.
 func NewConfigLineFromJson(s string) (*ConfigLine, error) {
 	ret := &ConfigLine{}
-	err := json.Unmarshal([]byte(s), ret)
+	err := decodeJson(s, ret, false)
 	if err != nil {
 		return nil, err
 	}
 	return ret, nil
 }
 
+// NewConfigLineFromJsonStrict returns ConfigLine via Json s.
+//  Unlike NewConfigLineFromJson, unknown keys like a typo of "condition" are error.
+func NewConfigLineFromJsonStrict(s string) (*ConfigLine, error) {
+	ret := &ConfigLine{}
+	err := decodeJson(s, ret, true)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// NewConfigLinesFromJson returns ConfigLines via Json s.
+//  s is an array of Json objects or a Json object. Each of them should have "type".
+func NewConfigLinesFromJson(s string) ([]ConfigLine, error) {
+	return newConfigLines(s, false)
+}
+
+// NewConfigLinesFromJsonStrict is same as NewConfigLinesFromJson but unknown keys are error.
+func NewConfigLinesFromJsonStrict(s string) ([]ConfigLine, error) {
+	return newConfigLines(s, true)
+}
+
+func newConfigLines(s string, strict bool) ([]ConfigLine, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "[") {
+		line := ConfigLine{}
+		err := decodeJson(s, &line, strict)
+		if err != nil {
+			return nil, err
+		}
+		return []ConfigLine{line}, nil
+	}
+	ret := []ConfigLine{}
+	err := decodeJson(s, &ret, strict)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// decodeJson decodes Json s to v. If strict is true, unknown keys are error.
+//  Numbers are decoded as json.Number to keep the precision of integers.
+func decodeJson(s string, v interface{}, strict bool) error {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	err := dec.Decode(v)
+	if err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("invalid data after top-level value")
+	}
+	return nil
+}
+
+// SetConfigLine set c as the rule name.
+//  name is the one of ConfigRuleNames.
+//  If c has a rule set name or a tag pattern, c is set to the RuleSet.
+func (cnf *Config) SetConfigLine(name string, c *ConfigLine) error {
+	if c == nil {
+		return errors.New("ConfigLine is nil")
+	}
+	if c.ClSeverity != "" {
+		if _, err := ParseSeverity(c.ClSeverity); err != nil {
+			return err
+		}
+	}
+	if name == ConfigUseKeyName {
+		return cnf.SetUse(c)
+	}
+	key, err := cnf.Definitions.ResolveKey(c.ClKey)
+	if err != nil {
+		return err
+	}
+	if key != nil {
+		line := *c
+		line.ClKey = key
+		c = &line
+	}
+	if c.ClRuleSet != "" {
+		rs := cnf.namedRuleSet(c.ClRuleSet)
+		line := *c
+		line.ClRuleSet = ""
+		return rs.Config.SetConfigLine(name, &line)
+	}
+	if name == ConfigRuleSetKeyName {
+		return cnf.SetRuleSet(c)
+	}
+	if c.ClTag != "" {
+		rs, err := cnf.tagRuleSet(c.ClTag)
+		if err != nil {
+			return err
+		}
+		line := *c
+		line.ClTag = ""
+		return rs.Config.SetConfigLine(name, &line)
+	}
+
+	switch name {
+	case ConfigExistKeyName:
+		return cnf.SetExist(c, true)
+	case ConfigNotExistKeyName:
+		return cnf.SetExist(c, false)
+	case ConfigBoolKeyName:
+		return cnf.SetTypeCondition(c, types.Bool)
+	case ConfigStrKeyName:
+		return cnf.SetTypeCondition(c, types.String)
+	case ConfigIntKeyName:
+		return cnf.SetTypeCondition(c, types.Int)
+	case ConfigUintKeyName:
+		return cnf.SetTypeCondition(c, types.Uint)
+	case ConfigDoubleKeyName:
+		return cnf.SetTypeCondition(c, types.Float64)
+	case ConfigFormatKeyName:
+		return cnf.SetFormatCondition(c)
+	case ConfigTimeKeyName:
+		return cnf.SetTimeCondition(c)
+	case ConfigEventTimeKeyName:
+		return cnf.SetEventTimeCondition(c)
+	}
+	if f, ok := lookupMatcher(name); ok {
+		line := *c
+		line.ClType = strings.TrimPrefix(name, "key_")
+		return cnf.SetMatcher(&line, f)
+	}
+	return fmt.Errorf("unknown rule:%s", name)
+}
+
 // v (string or []string) -> *Keys
 func convertKeys(v interface{}) (*Keys, error) {
 	var ss []string
@@ -85,19 +303,30 @@ func convertKeys(v interface{}) (*Keys, error) {
 			}
 		}
 	}
+	if len(ss) == 0 {
+		return nil, errors.New("blank key")
+	}
 	ret := &Keys{Keys: ss}
+	if looksPseudo(ss[0]) {
+		if !isPseudo(ss[0]) || len(ss) > 1 {
+			return nil, fmt.Errorf("invalid pseudo-field:%s", ss[0])
+		}
+		ret.pseudo = true
+	} else {
+		ss[0] = unescapePseudo(ss[0])
+	}
 	ret.FlattenKeys = ret.String()
 
 	return ret, nil
 }
 
-func containsKeys(keyss []Keys, ks *Keys) bool {
+func containsKeys(keys []Keys, ks *Keys) bool {
 	if ks == nil || len(ks.Keys) == 0 {
 		return false
 	}
 
-	for _, keys := range keyss {
-		if keys.Compare(*ks) {
+	for _, k := range keys {
+		if k.Compare(*ks) {
 			return true
 		}
 	}
@@ -120,7 +349,7 @@ func (cnf *Config) HasTypeCondition(t *TypeCondition) bool {
 		return false
 	}
 	for _, tc := range cnf.TypeConditions {
-		if tc.Keys.Compare(t.Keys) && tc.Condition.Compare(t.Condition) {
+		if tc.Keys.Compare(t.Keys) && tc.matcher().Equal(t.matcher()) {
 			return true
 		}
 	}
@@ -57,3 +57,107 @@ func TestConflict(t *testing.T) {
 	}
 
 }
+
+func TestNewConfigLineFromJsonStrict(t *testing.T) {
+	okCases := []string{
+		`{"key":"a", "condition":"==", "value":1}`,
+		`{"name":"login", "when":[{"type":"exists", "key":"a"}]}`,
+	}
+	for i, v := range okCases {
+		_, err := NewConfigLineFromJsonStrict(v)
+		if err != nil {
+			t.Errorf("%d:%s err:%s", i, v, err)
+		}
+	}
+
+	ngCases := []string{
+		`{"key":"a", "conditon":"==", "value":1}`,
+		`{"name":"login", "when":[{"type":"exists", "keys":"a"}]}`,
+		`{"key":"a"} {"key":"b"}`,
+		`{"key":"a"`,
+	}
+	for i, v := range ngCases {
+		_, err := NewConfigLineFromJsonStrict(v)
+		if err == nil {
+			t.Errorf("%d:%s should be error", i, v)
+		}
+	}
+}
+
+func TestValidateRuleSet(t *testing.T) {
+	cnf := &Config{}
+	lines := []string{
+		`{"key":"a", "tag":"app.*"}`,
+		`{"key":"a"}`,
+	}
+	for i, v := range lines {
+		cnfl, err := NewConfigLineFromJson(v)
+		if err != nil {
+			t.Fatalf("%d:NewConfigLine err:%s", i, err)
+		}
+		err = cnf.SetConfigLine(ConfigExistKeyName, cnfl)
+		if err != nil {
+			t.Fatalf("%d:SetConfigLine err:%s", i, err)
+		}
+	}
+	if err := cnf.Validate(); err != nil {
+		t.Errorf("Validate err:%s", err)
+	}
+
+	cnfl, err := NewConfigLineFromJson(`{"key":"a", "tag":"app.*"}`)
+	if err != nil {
+		t.Fatalf("NewConfigLine err:%s", err)
+	}
+	err = cnf.SetConfigLine(ConfigNotExistKeyName, cnfl)
+	if err != nil {
+		t.Fatalf("SetConfigLine err:%s", err)
+	}
+	err = cnf.Validate()
+	expect := `tag app.*:conflict key:"a"`
+	if err == nil {
+		t.Errorf("It should be conflict")
+	} else if err.Error() != expect {
+		t.Errorf("mismatch:\n given :%s\n expect:%s", err, expect)
+	}
+}
+
+func TestNewConfigLinesFromJson(t *testing.T) {
+	type testcase struct {
+		json   string
+		expect []string
+	}
+	cases := []testcase{
+		{`[{"type":"exists", "key":"a"}, {"type":"int", "key":"b", "condition":">", "value":1}]`, []string{"exists", "int"}},
+		{` {"type":"str", "key":"a", "condition":"==", "value":"x"} `, []string{"str"}},
+		{`[]`, []string{}},
+	}
+	for i, v := range cases {
+		ret, err := NewConfigLinesFromJson(v.json)
+		if err != nil {
+			t.Errorf("%d:NewConfigLinesFromJson err:%s", i, err)
+			continue
+		}
+		if len(ret) != len(v.expect) {
+			t.Errorf("%d:length mismatch:\n given :%+v\n expect:%v", i, ret, v.expect)
+			continue
+		}
+		for j, line := range ret {
+			if line.ClType != v.expect[j] {
+				t.Errorf("%d:%d mismatch:\n given :%s\n expect:%s", i, j, line.ClType, v.expect[j])
+			}
+		}
+	}
+
+	_, err := NewConfigLinesFromJson(`[{"type":"exists", "key":"a"},]`)
+	if err == nil {
+		t.Errorf("invalid json should be error")
+	}
+	_, err = NewConfigLinesFromJson(`[{"type":"exists", "keys":"a"}]`)
+	if err != nil {
+		t.Errorf("unknown key should be ignored. err:%s", err)
+	}
+	_, err = NewConfigLinesFromJsonStrict(`[{"type":"exists", "keys":"a"}]`)
+	if err == nil {
+		t.Errorf("unknown key should be error in strict")
+	}
+}
@@ -0,0 +1,266 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const ConfigUseKeyName = "use"
+
+// maxTemplateDepth limits "use" in templates to detect recursion.
+const maxTemplateDepth = 16
+
+// Definitions represents aliases of keys and templates of rules.
+type Definitions struct {
+	Aliases   map[string][]string     `json:"aliases,omitempty"`   // e.g. "k8s" -> ["kubernetes", "labels"]
+	Templates map[string][]ConfigLine `json:"templates,omitempty"` // rules which have "type". Keys are relative to "at" of "use".
+}
+
+// NewDefinitions returns empty Definitions.
+func NewDefinitions() *Definitions {
+	return &Definitions{Aliases: map[string][]string{}, Templates: map[string][]ConfigLine{}}
+}
+
+// Add adds aliases and templates of doc to d.
+//  Defining the same name twice is error.
+func (d *Definitions) Add(doc *RuleDocument) error {
+	if doc == nil {
+		return errors.New("RuleDocument is nil")
+	}
+	for name, keys := range doc.Aliases {
+		if name == "" || strings.HasPrefix(name, "@") {
+			return fmt.Errorf("invalid alias name:%q", name)
+		}
+		if _, ok := d.Aliases[name]; ok {
+			return fmt.Errorf("alias %s already defined", name)
+		}
+		if len(keys) == 0 {
+			return fmt.Errorf("alias %s:blank key", name)
+		}
+		for _, k := range keys {
+			if k == "" {
+				return fmt.Errorf("alias %s:blank key", name)
+			}
+		}
+		d.Aliases[name] = keys
+	}
+	for name, lines := range doc.Templates {
+		if name == "" {
+			return errors.New("blank template name")
+		}
+		if _, ok := d.Templates[name]; ok {
+			return fmt.Errorf("template %s already defined", name)
+		}
+		for i := range lines {
+			if _, err := lines[i].RuleName(); err != nil {
+				return fmt.Errorf("template %s[%d]:%w", name, i, err)
+			}
+		}
+		d.Templates[name] = lines
+	}
+	return nil
+}
+
+// keyStrings converts the key of ConfigLine to strings.
+func keyStrings(key interface{}) ([]string, error) {
+	switch k := key.(type) {
+	case string:
+		return []string{k}, nil
+	case []string:
+		return k, nil
+	case []interface{}:
+		ret := make([]string, len(k))
+		for i, v := range k {
+			s, ok := v.(string)
+			if !ok {
+				return nil, errors.New("cannot convert key string")
+			}
+			ret[i] = s
+		}
+		return ret, nil
+	}
+	return nil, errors.New("cannot convert key array")
+}
+
+// ResolveKey resolves the alias of key like ["@k8s", "app"].
+//  "@@" is used to write "@" literally. An undefined alias is an error.
+//  It returns nil if key has no alias.
+func (d *Definitions) ResolveKey(key interface{}) (interface{}, error) {
+	ss, err := keyStrings(key)
+	if err != nil || len(ss) == 0 || !strings.HasPrefix(ss[0], "@") {
+		return nil, nil
+	}
+	ret := []interface{}{}
+	switch alias, ok := d.alias(ss[0][1:]); {
+	case strings.HasPrefix(ss[0], "@@"):
+		ret = append(ret, ss[0][1:])
+	case ok:
+		for _, k := range alias {
+			ret = append(ret, k)
+		}
+	default:
+		return nil, fmt.Errorf("undefined alias:%s", ss[0])
+	}
+	for _, k := range ss[1:] {
+		ret = append(ret, k)
+	}
+	return ret, nil
+}
+
+func (d *Definitions) alias(name string) ([]string, bool) {
+	if d == nil {
+		return nil, false
+	}
+	keys, ok := d.Aliases[name]
+	return keys, ok
+}
+
+// Expand returns rules of the template which c uses.
+//  Keys of the rules are joined to "at" of c. "tag", "ruleset" and metadata of c are set to the rules
+//  which don't have them.
+func (d *Definitions) Expand(c *ConfigLine) ([]ConfigLine, error) {
+	return d.expand(c, 0)
+}
+
+func (d *Definitions) expand(c *ConfigLine, depth int) ([]ConfigLine, error) {
+	if c == nil {
+		return nil, errors.New("ConfigLine is nil")
+	}
+	if depth >= maxTemplateDepth {
+		return nil, fmt.Errorf("template %s:too deep", c.ClTemplate)
+	}
+	if c.ClTemplate == "" {
+		return nil, errors.New("blank template")
+	}
+	var lines []ConfigLine
+	if d != nil {
+		lines = d.Templates[c.ClTemplate]
+	}
+	if lines == nil {
+		return nil, fmt.Errorf("undefined template:%s", c.ClTemplate)
+	}
+
+	var at []string
+	if c.ClAt != nil {
+		key := c.ClAt
+		resolved, err := d.ResolveKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("template %s:at:%w", c.ClTemplate, err)
+		}
+		if resolved != nil {
+			key = resolved
+		}
+		k, err := convertKeys(key)
+		if err != nil {
+			return nil, fmt.Errorf("template %s:at:%w", c.ClTemplate, err)
+		}
+		if k.pseudo {
+			return nil, fmt.Errorf("template %s:at:pseudo-field can not be used", c.ClTemplate)
+		}
+		at = k.Keys
+	}
+
+	ret := []ConfigLine{}
+	for i := range lines {
+		line := lines[i]
+		if line.ClTag == "" {
+			line.ClTag = c.ClTag
+		}
+		if line.ClRuleSet == "" {
+			line.ClRuleSet = c.ClRuleSet
+		}
+		line.setMetadata(c.metadata())
+		line.ClParam = c.ClParam
+		if line.ClType == ConfigUseKeyName {
+			if len(at) > 0 {
+				key, err := joinKeys(d, at, line.ClAt)
+				if err != nil {
+					return nil, fmt.Errorf("template %s[%d]:%w", c.ClTemplate, i, err)
+				}
+				line.ClAt = key
+			}
+			used, err := d.expand(&line, depth+1)
+			if err != nil {
+				return nil, fmt.Errorf("template %s[%d]:%w", c.ClTemplate, i, err)
+			}
+			ret = append(ret, used...)
+			continue
+		}
+		if len(at) > 0 && line.ClKey != nil {
+			key, err := joinKeys(d, at, line.ClKey)
+			if err != nil {
+				return nil, fmt.Errorf("template %s[%d]:%w", c.ClTemplate, i, err)
+			}
+			line.ClKey = key
+		}
+		ret = append(ret, line)
+	}
+	return ret, nil
+}
+
+// joinKeys returns at + key. The alias of key is resolved.
+func joinKeys(d *Definitions, at []string, key interface{}) (interface{}, error) {
+	if key == nil {
+		return toInterfaces(at), nil
+	}
+	resolved, err := d.ResolveKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if resolved != nil {
+		key = resolved
+	}
+	ss, err := keyStrings(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ss) > 0 && looksPseudo(ss[0]) {
+		// pseudo-field is not relative.
+		return key, nil
+	}
+	return toInterfaces(append(append([]string{}, at...), ss...)), nil
+}
+
+func toInterfaces(ss []string) []interface{} {
+	ret := make([]interface{}, len(ss))
+	for i, s := range ss {
+		ret[i] = s
+	}
+	return ret
+}
+
+// SetUse sets rules of the template which c uses.
+func (cnf *Config) SetUse(c *ConfigLine) error {
+	lines, err := cnf.Definitions.Expand(c)
+	if err != nil {
+		return fmt.Errorf("SetUse:%w", err)
+	}
+	for i := range lines {
+		name, err := lines[i].RuleName()
+		if err != nil {
+			return fmt.Errorf("SetUse:%s[%d]:%w", c.ClTemplate, i, err)
+		}
+		err = cnf.SetConfigLine(name, &lines[i])
+		if err != nil {
+			return fmt.Errorf("SetUse:%s[%d]:%w", c.ClTemplate, i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"strings"
+	"testing"
+)
+
+const testDefinitionsJson = `{
+  "aliases": {"k8s": ["kubernetes", "labels"]},
+  "templates": {
+    "http_shape": [
+      {"type":"exists", "key":"status"},
+      {"type":"int", "key":"status", "condition":">=", "value":100},
+      {"type":"int", "key":"status", "condition":"<=", "value":599},
+      {"type":"str", "key":"method", "condition":"regex", "value":"^(GET|POST|PUT|DELETE)$"},
+      {"type":"str", "key":"path", "condition":"contains", "value":"/"}
+    ],
+    "service": [
+      {"type":"exists", "key":"@k8s"},
+      {"type":"use", "template":"http_shape", "at":"request"}
+    ]
+  },
+  "rules": [
+    {"type":"str", "key":["@k8s", "app"], "condition":"==", "value":"web"},
+    {"type":"exists", "key":"@@timestamp"},
+    {"type":"exists", "key":"@@version"}
+  ]
+}`
+
+func TestDefinitions(t *testing.T) {
+	d, err := NewRuleDocumentFromJson([]byte(testDefinitionsJson))
+	if err != nil {
+		t.Fatalf("NewRuleDocumentFromJson err:%s", err)
+	}
+	cnf := &Config{}
+	err = cnf.ApplyRuleDocument(d)
+	if err != nil {
+		t.Fatalf("ApplyRuleDocument err:%s", err)
+	}
+
+	lines, err := ParseRules(`use http_shape at $request; use service at $web tag app.*`)
+	if err != nil {
+		t.Fatalf("ParseRules err:%s", err)
+	}
+	err = cnf.ApplyRuleDocument(&RuleDocument{Rules: lines})
+	if err != nil {
+		t.Fatalf("ApplyRuleDocument err:%s", err)
+	}
+
+	expect := []string{
+		`"kubernetes"->"labels"->"app" == web`,
+		`"request"->"status" >= 100`,
+		`"request"->"status" <= 599`,
+		`"request"->"method" regex ^(GET|POST|PUT|DELETE)$`,
+		`"request"->"path" contains /`,
+	}
+	if len(cnf.TypeConditions) != len(expect) {
+		t.Fatalf("length mismatch:%+v", cnf.TypeConditions)
+	}
+	for i, v := range cnf.TypeConditions {
+		if v.TypeConditionStr != expect[i] {
+			t.Errorf("%d mismatch:\n given :%s\n expect:%s", i, v.TypeConditionStr, expect[i])
+		}
+	}
+
+	expectExists := []string{`"@timestamp"`, `"@version"`, `"request"->"status"`}
+	if len(cnf.Exists) != len(expectExists) {
+		t.Fatalf("length mismatch:%+v", cnf.Exists)
+	}
+	for i, v := range cnf.Exists {
+		if v.FlattenKeys != expectExists[i] {
+			t.Errorf("%d mismatch:\n given :%s\n expect:%s", i, v.FlattenKeys, expectExists[i])
+		}
+	}
+
+	if len(cnf.RuleSets) != 1 || cnf.RuleSets[0].Tag.String() != "app.*" {
+		t.Fatalf("rule set mismatch:%+v", cnf.RuleSets)
+	}
+	rs := cnf.RuleSets[0]
+	if len(rs.Exists) != 2 || rs.Exists[0].FlattenKeys != `"web"->"kubernetes"->"labels"` || len(rs.TypeConditions) != 4 {
+		t.Errorf("used template mismatch:%+v", rs.Config)
+	}
+}
+
+func TestDefinitionsError(t *testing.T) {
+	cnf := &Config{}
+	err := cnf.ApplyRuleDocument(&RuleDocument{Templates: map[string][]ConfigLine{
+		"loop": {{ClType: ConfigUseKeyName, ClTemplate: "loop"}},
+		"bad":  {{ClType: "integer", ClKey: "a"}},
+	}})
+	if err == nil {
+		t.Errorf("unknown type in template should be error")
+	}
+
+	cnf = &Config{}
+	err = cnf.ApplyRuleDocument(&RuleDocument{Templates: map[string][]ConfigLine{
+		"loop": {{ClType: ConfigUseKeyName, ClTemplate: "loop"}},
+	}})
+	if err != nil {
+		t.Fatalf("ApplyRuleDocument err:%s", err)
+	}
+	err = cnf.SetConfigLine(ConfigUseKeyName, &ConfigLine{ClTemplate: "loop"})
+	if err == nil {
+		t.Errorf("recursion should be error")
+	}
+	err = cnf.SetConfigLine(ConfigUseKeyName, &ConfigLine{ClTemplate: "undefined"})
+	if err == nil {
+		t.Errorf("undefined template should be error")
+	}
+
+	defs := NewDefinitions()
+	doc := &RuleDocument{Aliases: map[string][]string{"a": {"x"}}}
+	if err := defs.Add(doc); err != nil {
+		t.Fatalf("Add err:%s", err)
+	}
+	if err := defs.Add(doc); err == nil {
+		t.Errorf("defining twice should be error")
+	}
+	if err := defs.Add(&RuleDocument{Aliases: map[string][]string{"b": {}}}); err == nil {
+		t.Errorf("blank alias should be error")
+	}
+	err = cnf.SetConfigLine("key_exists0", &ConfigLine{ClKey: "@undefined"})
+	if err == nil || !strings.Contains(err.Error(), "undefined alias:@undefined") {
+		t.Errorf("undefined alias should be error. err=%v", err)
+	}
+	err = cnf.ApplyRuleDocument(&RuleDocument{Templates: map[string][]ConfigLine{
+		"t": {{ClType: "exists", ClKey: "a"}},
+	}})
+	if err != nil {
+		t.Fatalf("ApplyRuleDocument err:%s", err)
+	}
+	err = cnf.SetConfigLine(ConfigUseKeyName, &ConfigLine{ClTemplate: "t", ClAt: []interface{}{"@undefined", "a"}})
+	if err == nil || !strings.Contains(err.Error(), "undefined alias:@undefined") {
+		t.Errorf("undefined alias of at should be error. err=%v", err)
+	}
+}
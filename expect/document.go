@@ -0,0 +1,124 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const ConfigRulesFileKeyName = "rules_file"
+const ConfigRulesKeyName = "rules"
+
+// RuleDocument represents a document of rules like a rules file.
+//  Each rule is ConfigLine which has "type".
+type RuleDocument struct {
+	Rules     []ConfigLine            `json:"rules"`
+	Aliases   map[string][]string     `json:"aliases,omitempty"`   // see Definitions
+	Templates map[string][]ConfigLine `json:"templates,omitempty"` // see Definitions
+}
+
+// NewRuleDocumentFromJson returns RuleDocument via Json b.
+//  b is an array of rules or an object which has "rules".
+func NewRuleDocumentFromJson(b []byte) (*RuleDocument, error) {
+	ret := &RuleDocument{}
+	b = bytes.TrimSpace(b)
+	if bytes.HasPrefix(b, []byte("[")) {
+		err := decodeJson(string(b), &ret.Rules, false)
+		if err != nil {
+			return nil, err
+		}
+		return ret, nil
+	}
+	err := decodeJson(string(b), ret, false)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// NewRuleDocumentFromYaml returns RuleDocument via Yaml b.
+//  The structure is same as Json.
+func NewRuleDocumentFromYaml(b []byte) (*RuleDocument, error) {
+	var v interface{}
+	err := yaml.Unmarshal(b, &v)
+	if err != nil {
+		return nil, err
+	}
+	jb, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("yaml convert error:%w", err)
+	}
+	return NewRuleDocumentFromJson(jb)
+}
+
+// LoadRuleDocument reads RuleDocument from the file path.
+//  If the extension is ".yaml" or ".yml", it is read as Yaml. Otherwise it is read as Json.
+func LoadRuleDocument(path string) (*RuleDocument, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return NewRuleDocumentFromYaml(b)
+	}
+	return NewRuleDocumentFromJson(b)
+}
+
+// RuleName returns the rule name of c via "type".
+func (c ConfigLine) RuleName() (string, error) {
+	if c.ClType == "" {
+		return "", fmt.Errorf("type is not specified")
+	}
+	return RuleNameOfType(c.ClType)
+}
+
+// ApplyRuleDocument sets all rules of d to cnf.
+//  It stops at the first invalid rule and returns the error with the index.
+func (cnf *Config) ApplyRuleDocument(d *RuleDocument) error {
+	if d == nil {
+		return errors.New("RuleDocument is nil")
+	}
+	if len(d.Aliases) > 0 || len(d.Templates) > 0 {
+		if cnf.Definitions == nil {
+			cnf.Definitions = NewDefinitions()
+		}
+		err := cnf.Definitions.Add(d)
+		if err != nil {
+			return err
+		}
+	}
+	for i := range d.Rules {
+		name, err := d.Rules[i].RuleName()
+		if err != nil {
+			return fmt.Errorf("rules[%d]:%w", i, err)
+		}
+		err = cnf.SetConfigLine(name, &d.Rules[i])
+		if err != nil {
+			return fmt.Errorf("rules[%d]:%w", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testRulesJson = `{"rules":[
+  {"type":"exists", "key":["http","status"]},
+  {"type":"int", "key":["http","status"], "condition":"<", "value":500},
+  {"type":"str", "key":"path", "condition":"contains", "value":"/", "tag":"app.*"}
+]}`
+
+const testRulesYaml = `
+rules:
+  - type: exists
+    key: [http, status]
+  - type: int
+    key: [http, status]
+    condition: "<"
+    value: 500
+  - type: str
+    key: path
+    condition: contains
+    value: /
+    tag: app.*
+`
+
+func testRuleDocument(t *testing.T, d *RuleDocument) {
+	t.Helper()
+
+	if len(d.Rules) != 3 {
+		t.Fatalf("len(d.Rules)=%d != 3", len(d.Rules))
+	}
+	cnf := &Config{}
+	for i, rule := range d.Rules {
+		name, err := rule.RuleName()
+		if err != nil {
+			t.Fatalf("%d:RuleName err:%s", i, err)
+		}
+		err = cnf.SetConfigLine(name, &d.Rules[i])
+		if err != nil {
+			t.Fatalf("%d:SetConfigLine err:%s", i, err)
+		}
+	}
+	if len(cnf.Exists) != 1 || len(cnf.TypeConditions) != 1 || len(cnf.RuleSets) != 1 {
+		t.Errorf("config mismatch: %+v", cnf)
+	}
+	expect := `"http"->"status" < 500`
+	if cnf.TypeConditions[0].TypeConditionStr != expect {
+		t.Errorf("mismatch:\n given :%s\n expect:%s", cnf.TypeConditions[0].TypeConditionStr, expect)
+	}
+}
+
+func TestNewRuleDocumentFromJson(t *testing.T) {
+	d, err := NewRuleDocumentFromJson([]byte(testRulesJson))
+	if err != nil {
+		t.Fatalf("NewRuleDocumentFromJson err:%s", err)
+	}
+	testRuleDocument(t, d)
+
+	d, err = NewRuleDocumentFromJson([]byte(`[{"type":"not_exists", "key":"debug"}]`))
+	if err != nil {
+		t.Fatalf("NewRuleDocumentFromJson(array) err:%s", err)
+	}
+	if len(d.Rules) != 1 || d.Rules[0].ClType != "not_exists" {
+		t.Errorf("array mismatch: %+v", d)
+	}
+
+	_, err = NewRuleDocumentFromJson([]byte(`{"rules":[{"type":"exists", "key":"a"},]}`))
+	if err == nil {
+		t.Errorf("invalid json should be error")
+	}
+}
+
+func TestRuleNumberPrecision(t *testing.T) {
+	rules := `[
+  {"type":"int", "key":"n", "condition":"==", "value":9007199254740993},
+  {"type":"uint", "key":"u", "condition":"==", "value":18446744073709551615},
+  {"type":"double", "key":"d", "condition":"<", "value":1.5},
+  {"type":"time", "key":"t", "condition":">", "value":1609459200, "layout":"epoch"}
+]`
+	expect := []string{`"n" == 9007199254740993`, `"u" == 18446744073709551615`, `"d" < 1.5`}
+
+	docs := map[string]func() (*RuleDocument, error){
+		"json": func() (*RuleDocument, error) {
+			return NewRuleDocumentFromJson([]byte(rules))
+		},
+		"yaml": func() (*RuleDocument, error) {
+			return NewRuleDocumentFromYaml([]byte(rules))
+		},
+		"lines": func() (*RuleDocument, error) {
+			lines, err := NewConfigLinesFromJson(rules)
+			return &RuleDocument{Rules: lines}, err
+		},
+		"template": func() (*RuleDocument, error) {
+			d, err := NewRuleDocumentFromJson([]byte(strings.Replace(rules, "9007199254740993", `"${BIG}"`, 1)))
+			if err != nil {
+				return nil, err
+			}
+			return d, newTestTemplate().ExpandRuleDocument(d)
+		},
+	}
+	for name, f := range docs {
+		d, err := f()
+		if err != nil {
+			t.Fatalf("%s: err:%s", name, err)
+		}
+		cnf := &Config{}
+		if err := cnf.ApplyRuleDocument(d); err != nil {
+			t.Fatalf("%s: ApplyRuleDocument err:%s", name, err)
+		}
+		if len(cnf.TypeConditions) != len(expect) || len(cnf.TimeConditions) != 1 {
+			t.Fatalf("%s: config mismatch:%+v", name, cnf)
+		}
+		for i, v := range cnf.TypeConditions {
+			if v.TypeConditionStr != expect[i] {
+				t.Errorf("%s %d: mismatch:\n given :%s\n expect:%s", name, i, v.TypeConditionStr, expect[i])
+			}
+		}
+	}
+
+	line, err := NewConfigLineFromJson(`{"key":"n", "condition":"==", "value":9007199254740993}`)
+	if err != nil {
+		t.Fatalf("NewConfigLineFromJson err:%s", err)
+	}
+	if line.ClValue != json.Number("9007199254740993") {
+		t.Errorf("value mismatch:%#v", line.ClValue)
+	}
+}
+
+func TestNewRuleDocumentFromYaml(t *testing.T) {
+	d, err := NewRuleDocumentFromYaml([]byte(testRulesYaml))
+	if err != nil {
+		t.Fatalf("NewRuleDocumentFromYaml err:%s", err)
+	}
+	testRuleDocument(t, d)
+}
+
+func TestLoadRuleDocument(t *testing.T) {
+	dir, err := ioutil.TempDir("", "expect")
+	if err != nil {
+		t.Fatalf("TempDir err:%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"rules.json": testRulesJson,
+		"rules.yaml": testRulesYaml,
+		"rules.yml":  testRulesYaml,
+	}
+	for name, body := range files {
+		path := filepath.Join(dir, name)
+		err = ioutil.WriteFile(path, []byte(body), 0644)
+		if err != nil {
+			t.Fatalf("WriteFile err:%s", err)
+		}
+		d, err := LoadRuleDocument(path)
+		if err != nil {
+			t.Fatalf("%s:LoadRuleDocument err:%s", name, err)
+		}
+		testRuleDocument(t, d)
+	}
+
+	_, err = LoadRuleDocument(filepath.Join(dir, "missing.json"))
+	if err == nil {
+		t.Errorf("missing file should be error")
+	}
+}
+
+func TestRuleName(t *testing.T) {
+	_, err := ConfigLine{}.RuleName()
+	if err == nil {
+		t.Errorf("no type should be error")
+	}
+}
+
+func TestApplyRuleDocument(t *testing.T) {
+	d, err := NewRuleDocumentFromJson([]byte(`[{"type":"exists", "key":"a"},{"type":"integer", "key":"b"}]`))
+	if err != nil {
+		t.Fatalf("NewRuleDocumentFromJson err:%s", err)
+	}
+	cnf := &Config{}
+	err = cnf.ApplyRuleDocument(d)
+	if err == nil {
+		t.Fatalf("unknown type should be error")
+	}
+	expect := `rules[1]:unknown type:"integer"`
+	if err.Error() != expect {
+		t.Errorf("mismatch:\n given :%s\n expect:%s", err, expect)
+	}
+}
@@ -0,0 +1,500 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const ConfigExpectKeyName = "expect"
+
+// SyntaxError represents an error of the rule text.
+type SyntaxError struct {
+	Line   int // starts from 1
+	Column int // starts from 1
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// token represents a word or a separator of the rule text.
+type token struct {
+	text   string // raw text. quotes are not removed.
+	sep    bool   // ";" or the end of line.
+	line   int
+	column int
+}
+
+func (t token) errorf(format string, a ...interface{}) error {
+	return &SyntaxError{Line: t.line, Column: t.column, Msg: fmt.Sprintf(format, a...)}
+}
+
+// isQuoted check if the whole of t is a quoted string.
+func (t token) isQuoted() bool {
+	if len(t.text) < 2 || t.text[0] != '"' {
+		return false
+	}
+	n, ok := quotedLen(t.text)
+	return ok && n == len(t.text)
+}
+
+// quotedLen returns the length of the quoted string at the head of s.
+func quotedLen(s string) (int, bool) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+// tokenize splits s into tokens.
+//  Words are separated by spaces. A word can have quoted strings which contain spaces.
+//  "#" starts a comment until the end of line.
+func tokenize(s string) ([]token, error) {
+	ret := []token{}
+	line, column := 1, 1
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '\n' || r == ';':
+			ret = append(ret, token{text: string(r), sep: true, line: line, column: column})
+			i += size
+			if r == '\n' {
+				line, column = line+1, 1
+			} else {
+				column++
+			}
+			continue
+		case r == ' ' || r == '\t' || r == '\r':
+			i += size
+			column++
+			continue
+		case r == '#':
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+			continue
+		}
+
+		t := token{line: line, column: column}
+		start := i
+		for i < len(s) {
+			r, size = utf8.DecodeRuneInString(s[i:])
+			if r == ' ' || r == '\t' || r == '\r' || r == '\n' || r == ';' {
+				break
+			}
+			if r == '"' {
+				n, ok := quotedLen(s[i:])
+				if !ok {
+					return nil, &SyntaxError{Line: line, Column: column, Msg: "unterminated quoted string"}
+				}
+				if strings.Contains(s[i:i+n], "\n") {
+					return nil, &SyntaxError{Line: line, Column: column, Msg: "newline in quoted string"}
+				}
+				column += utf8.RuneCountInString(s[i : i+n])
+				i += n
+				continue
+			}
+			i += size
+			column++
+		}
+		t.text = s[start:i]
+		ret = append(ret, t)
+	}
+	return ret, nil
+}
+
+// parseKey converts the key of rule like `$http.status` to the key of ConfigLine.
+//  A segment can be quoted like `$"a.b".c`. `$TAG`, `$TAG[n]` and `$TIME` are pseudo-fields.
+func parseKey(t token) (interface{}, error) {
+	if !strings.HasPrefix(t.text, "$") || len(t.text) == 1 {
+		return nil, t.errorf("key should start with $ like $log.level:%s", t.text)
+	}
+	if isPseudo(t.text) {
+		return t.text, nil
+	}
+
+	keys := []interface{}{}
+	s := t.text[1:]
+	pos := 1
+	for {
+		var seg string
+		if strings.HasPrefix(s, `"`) {
+			n, _ := quotedLen(s)
+			var err error
+			seg, err = strconv.Unquote(s[:n])
+			if err != nil {
+				return nil, &SyntaxError{Line: t.line, Column: t.column + pos, Msg: "invalid quoted key"}
+			}
+			if len(keys) == 0 && looksPseudo(seg) {
+				// escape to use it literally.
+				seg = "$" + seg
+			}
+			s, pos = s[n:], pos+utf8.RuneCountInString(s[:n])
+		} else {
+			n := strings.IndexAny(s, `."`)
+			if n < 0 {
+				n = len(s)
+			}
+			seg = s[:n]
+			if len(keys) == 0 && looksPseudo("$"+seg) {
+				return nil, &SyntaxError{Line: t.line, Column: t.column, Msg: "invalid pseudo-field:" + t.text}
+			}
+			s, pos = s[n:], pos+utf8.RuneCountInString(s[:n])
+		}
+		if seg == "" {
+			return nil, &SyntaxError{Line: t.line, Column: t.column + pos, Msg: "blank key"}
+		}
+		keys = append(keys, seg)
+
+		if s == "" {
+			break
+		}
+		if s[0] != '.' {
+			return nil, &SyntaxError{Line: t.line, Column: t.column + pos, Msg: `expected "."`}
+		}
+		s, pos = s[1:], pos+1
+	}
+	if len(keys) == 1 {
+		return keys[0], nil
+	}
+	return keys, nil
+}
+
+// parseString returns the string of t. The quotes are removed.
+//  A quoted string is used literally even if it looks like a pseudo-field.
+func parseString(t token) (string, error) {
+	if t.isQuoted() {
+		s, err := strconv.Unquote(t.text)
+		if err != nil {
+			return "", t.errorf("invalid quoted string:%s", t.text)
+		}
+		if looksPseudo(s) {
+			s = "$" + s
+		}
+		return s, nil
+	}
+	if strings.Contains(t.text, `"`) {
+		return "", t.errorf("unexpected quote:%s", t.text)
+	}
+	return t.text, nil
+}
+
+// parseValue returns the value of ConfigLine via t like Json.
+//  Values of int and uint are json.Number to keep the precision.
+func parseValue(typ string, t token) (interface{}, error) {
+	if !t.isQuoted() && looksPseudo(t.text) {
+		if !isPseudo(t.text) {
+			return nil, t.errorf("invalid pseudo-field:%s", t.text)
+		}
+		return t.text, nil
+	}
+	if isTemplate(t.text) {
+		// it is converted after it is expanded.
+		return parseString(t)
+	}
+	switch typ {
+	case "bool":
+		b, err := strconv.ParseBool(t.text)
+		if err != nil {
+			return nil, t.errorf("invalid bool:%s", t.text)
+		}
+		return b, nil
+	case "int":
+		if _, err := strconv.ParseInt(t.text, 10, 64); err != nil {
+			return nil, t.errorf("invalid int:%s", t.text)
+		}
+		return json.Number(t.text), nil
+	case "uint":
+		if _, err := strconv.ParseUint(t.text, 10, 64); err != nil {
+			return nil, t.errorf("invalid uint:%s", t.text)
+		}
+		return json.Number(t.text), nil
+	case "double":
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, t.errorf("invalid double:%s", t.text)
+		}
+		return f, nil
+	case "time":
+		if f, err := strconv.ParseFloat(t.text, 64); err == nil {
+			return f, nil
+		}
+	}
+	return parseString(t)
+}
+
+// conditionsOfType is the list of conditions of each type.
+var conditionsOfType = map[string][]string{
+	"bool":   {"==", "!="},
+	"str":    {"==", "!=", "contains", "not_contains", "regex", "not_regex", "format", "not_format"},
+	"int":    {"==", "!=", ">", ">=", "<", "<=", "between"},
+	"uint":   {"==", "!=", ">", ">=", "<", "<=", "between"},
+	"double": {"==", "!=", ">", ">=", "<", "<=", "between"},
+	"time":   {"==", "!=", ">", ">=", "<", "<=", "between"},
+}
+
+// ruleParser parses tokens of a rule.
+type ruleParser struct {
+	tokens []token
+	pos    int
+	last   token // the last token. it is used for the error of the end of rule.
+}
+
+func (p *ruleParser) next(what string) (token, error) {
+	if p.pos >= len(p.tokens) {
+		return token{}, &SyntaxError{Line: p.last.line, Column: p.last.column + utf8.RuneCountInString(p.last.text), Msg: what + " is missing"}
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	p.last = t
+	return t, nil
+}
+
+// parse returns ConfigLines of the rule.
+func (p *ruleParser) parse() ([]ConfigLine, error) {
+	t, err := p.next("key")
+	if err != nil {
+		return nil, err
+	}
+	if t.text == ConfigUseKeyName {
+		return p.parseUse()
+	}
+	key, err := parseKey(t)
+	if err != nil {
+		return nil, err
+	}
+
+	verb, err := p.next("type")
+	if err != nil {
+		return nil, err
+	}
+	base := ConfigLine{ClKey: key}
+	lines := []ConfigLine{}
+
+	switch verb.text {
+	case "exists", "not_exists":
+		base.ClType = verb.text
+		lines = append(lines, base)
+	default:
+		if isMatcherFamily(verb.text) {
+			line, err := p.parseMatcher(base, verb.text)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, line)
+			break
+		}
+		conds, ok := conditionsOfType[verb.text]
+		if !ok {
+			return nil, verb.errorf("unknown type:%s", verb.text)
+		}
+		base.ClType = verb.text
+		c, err := p.next("condition")
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, v := range conds {
+			found = found || v == c.text
+		}
+		if !found {
+			return nil, c.errorf("unknown condition of %s:%s", verb.text, c.text)
+		}
+
+		switch c.text {
+		case "between":
+			for _, cs := range []string{">=", "<="} {
+				t, err := p.next("value")
+				if err != nil {
+					return nil, err
+				}
+				line := base
+				line.ClCondition = cs
+				line.ClValue, err = parseValue(verb.text, t)
+				if err != nil {
+					return nil, err
+				}
+				lines = append(lines, line)
+			}
+		case "format", "not_format":
+			t, err := p.next("format")
+			if err != nil {
+				return nil, err
+			}
+			line := base
+			line.ClType = "format"
+			line.ClCondition = c.text
+			line.ClValue, err = parseString(t)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, line)
+		default:
+			t, err := p.next("value")
+			if err != nil {
+				return nil, err
+			}
+			line := base
+			line.ClCondition = c.text
+			line.ClValue, err = parseValue(verb.text, t)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, p.parseOptions(verb.text, lines)
+}
+
+// parseMatcher parses "condition [value]" of the registered rule family typ.
+//  The value is string. It is omitted if the number of the rest tokens is even since options are pairs.
+func (p *ruleParser) parseMatcher(base ConfigLine, typ string) (ConfigLine, error) {
+	base.ClType = typ
+	c, err := p.next("condition")
+	if err != nil {
+		return base, err
+	}
+	base.ClCondition = c.text
+	if (len(p.tokens)-p.pos)%2 == 1 {
+		t, _ := p.next("value")
+		base.ClValue, err = parseString(t)
+		if err != nil {
+			return base, err
+		}
+	}
+	return base, nil
+}
+
+// parseUse parses "use template [at $key]".
+func (p *ruleParser) parseUse() ([]ConfigLine, error) {
+	t, err := p.next("template")
+	if err != nil {
+		return nil, err
+	}
+	name, err := parseString(t)
+	if err != nil {
+		return nil, err
+	}
+	line := ConfigLine{ClType: ConfigUseKeyName, ClTemplate: name}
+	if p.pos < len(p.tokens) && p.tokens[p.pos].text == "at" {
+		p.pos++
+		t, err := p.next("key")
+		if err != nil {
+			return nil, err
+		}
+		line.ClAt, err = parseKey(t)
+		if err != nil {
+			return nil, err
+		}
+	}
+	lines := []ConfigLine{line}
+	return lines, p.parseOptions(ConfigUseKeyName, lines)
+}
+
+// parseOptions parses options like "tag app.*" and "owner team-web" and sets them to lines.
+func (p *ruleParser) parseOptions(typ string, lines []ConfigLine) error {
+	for p.pos < len(p.tokens) {
+		opt, _ := p.next("option")
+		if (opt.text == "layout" || opt.text == "tz") && typ != "time" {
+			return opt.errorf("%s is only for time", opt.text)
+		}
+		t, err := p.next(opt.text)
+		if err != nil {
+			return err
+		}
+		s, err := parseString(t)
+		if err != nil {
+			return err
+		}
+		for i := range lines {
+			switch opt.text {
+			case "tag":
+				lines[i].ClTag = s
+			case "ruleset":
+				lines[i].ClRuleSet = s
+			case "layout":
+				lines[i].ClLayout = s
+			case "tz":
+				lines[i].ClTimezone = s
+			case "id":
+				lines[i].ClID = s
+			case "description":
+				lines[i].ClDescription = s
+			case "owner":
+				lines[i].ClOwner = s
+			case "runbook_url":
+				lines[i].ClRunbookURL = s
+			case "severity":
+				lines[i].ClSeverity = s
+			case "label":
+				kv := strings.SplitN(s, "=", 2)
+				if len(kv) != 2 || kv[0] == "" {
+					return t.errorf("label should be name=value:%s", s)
+				}
+				if lines[i].ClLabels == nil {
+					lines[i].ClLabels = map[string]string{}
+				}
+				lines[i].ClLabels[kv[0]] = kv[1]
+			default:
+				return opt.errorf("unknown option:%s", opt.text)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseRules returns ConfigLines via the rule text s.
+//  Rules are separated by ";" or newlines. e.g.
+//    $http.status int between 200 299; $user.email str regex ".+@.+"
+//    $debug not_exists tag app.*
+//  Each ConfigLine has "type". An error is SyntaxError which has the line and the column.
+func ParseRules(s string) ([]ConfigLine, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	ret := []ConfigLine{}
+	rule := []token{}
+	for i, t := range tokens {
+		if !t.sep {
+			rule = append(rule, t)
+		}
+		if (!t.sep && i < len(tokens)-1) || len(rule) == 0 {
+			continue
+		}
+		p := &ruleParser{tokens: rule}
+		lines, err := p.parse()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, lines...)
+		rule = []token{}
+	}
+	return ret, nil
+}
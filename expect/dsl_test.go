@@ -0,0 +1,163 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseRules(t *testing.T) {
+	type testcase struct {
+		name   string
+		input  string
+		expect string // Json of ConfigLines
+	}
+
+	cases := []testcase{
+		{"between", `$http.status int between 200 299`,
+			`[{"key":["http","status"],"condition":">=","value":200,"type":"int"},{"key":["http","status"],"condition":"<=","value":299,"type":"int"}]`},
+		{"regex", `$user.email str regex ".+@.+"`,
+			`[{"key":["user","email"],"condition":"regex","value":".+@.+","type":"str"}]`},
+		{"not_exists", `$debug not_exists`,
+			`[{"key":"debug","type":"not_exists"}]`},
+		{"multi", "$a exists; $b bool == true\n\n# comment\n$c double < 1.5 # comment",
+			`[{"key":"a","type":"exists"},{"key":"b","condition":"==","value":true,"type":"bool"},{"key":"c","condition":"<","value":1.5,"type":"double"}]`},
+		{"quoted key", `$"a.b".c str == "x y"`,
+			`[{"key":["a.b","c"],"condition":"==","value":"x y","type":"str"}]`},
+		{"pseudo", `$TAG[1] str == kube; $ns str == $TAG[2]; $"$TAG" str == "$TIME"`,
+			`[{"key":"$TAG[1]","condition":"==","value":"kube","type":"str"},{"key":"ns","condition":"==","value":"$TAG[2]","type":"str"},{"key":"$$TAG","condition":"==","value":"$$TIME","type":"str"}]`},
+		{"format", `$id str format uuid tag app.*`,
+			`[{"key":"id","condition":"format","value":"uuid","tag":"app.*","type":"format"}]`},
+		{"quoted format", `$id str not_format "uuid"`,
+			`[{"key":"id","condition":"not_format","value":"uuid","type":"format"}]`},
+		{"time", `$time time > now-10m layout "2006-01-02 15:04:05" tz Asia/Tokyo ruleset login`,
+			`[{"key":"time","condition":">","value":"now-10m","layout":"2006-01-02 15:04:05","timezone":"Asia/Tokyo","ruleset":"login","type":"time"}]`},
+		{"blank", " \n ; # comment", `[]`},
+	}
+
+	for _, v := range cases {
+		ret, err := ParseRules(v.input)
+		if err != nil {
+			t.Errorf("%s: ParseRules err:%s", v.name, err)
+			continue
+		}
+		expect := []ConfigLine{}
+		err = json.Unmarshal([]byte(v.expect), &expect)
+		if err != nil {
+			t.Fatalf("%s: Unmarshal err:%s", v.name, err)
+		}
+		b, _ := json.Marshal(ret)
+		eb, _ := json.Marshal(expect)
+		if string(b) != string(eb) {
+			t.Errorf("%s: mismatch:\n given :%s\n expect:%s", v.name, b, eb)
+		}
+	}
+}
+
+func TestParseRulesError(t *testing.T) {
+	type testcase struct {
+		input  string
+		expect string
+	}
+
+	cases := []testcase{
+		{`http.status int > 1`, `line 1, column 1: key should start with $ like $log.level:http.status`},
+		{`$a integer > 1`, `line 1, column 4: unknown type:integer`},
+		{`$a int contains 1`, `line 1, column 8: unknown condition of int:contains`},
+		{`$a int > x`, `line 1, column 10: invalid int:x`},
+		{`$a int between 1`, `line 1, column 17: value is missing`},
+		{`$a exists; $b str == "abc`, `line 1, column 22: unterminated quoted string`},
+		{"$a exists\n$b..c exists", `line 2, column 4: blank key`},
+		{`$a exists foo bar`, `line 1, column 11: unknown option:foo`},
+		{`$a int > 1 layout x`, `line 1, column 12: layout is only for time`},
+		{`$TAG[x] exists`, `line 1, column 1: invalid pseudo-field:$TAG[x]`},
+	}
+	for i, v := range cases {
+		_, err := ParseRules(v.input)
+		if err == nil {
+			t.Errorf("%d: %q should be error", i, v.input)
+			continue
+		}
+		if _, ok := err.(*SyntaxError); !ok {
+			t.Errorf("%d: error type mismatch:%T", i, err)
+		}
+		if err.Error() != v.expect {
+			t.Errorf("%d: mismatch:\n given :%s\n expect:%s", i, err, v.expect)
+		}
+	}
+}
+
+func TestParseRulesConfig(t *testing.T) {
+	lines, err := ParseRules(`$http.status int between 200 299; $user.email str regex ".+@.+"; $debug not_exists`)
+	if err != nil {
+		t.Fatalf("ParseRules err:%s", err)
+	}
+	cnf := &Config{}
+	err = cnf.ApplyRuleDocument(&RuleDocument{Rules: lines})
+	if err != nil {
+		t.Fatalf("ApplyRuleDocument err:%s", err)
+	}
+	if len(cnf.TypeConditions) != 3 || len(cnf.NotExists) != 1 {
+		t.Fatalf("config mismatch:%+v", cnf)
+	}
+
+	r := &Record{Map: map[interface{}]interface{}{
+		"http": map[interface{}]interface{}{"status": uint64(200)},
+		"user": map[interface{}]interface{}{"email": "a@example.com"},
+	}}
+	if !cnf.IsMatch(r, r.Time.Time) {
+		t.Errorf("record should match")
+	}
+	r.Map["debug"] = true
+	if cnf.IsMatch(r, r.Time.Time) {
+		t.Errorf("record should not match")
+	}
+}
+
+func TestParseRulesIntPrecision(t *testing.T) {
+	lines, err := ParseRules(`$i int == 9223372036854775807; $u uint == 18446744073709551615; $n int == 9007199254740993`)
+	if err != nil {
+		t.Fatalf("ParseRules err:%s", err)
+	}
+	cnf := &Config{}
+	if err := cnf.ApplyRuleDocument(&RuleDocument{Rules: lines}); err != nil {
+		t.Fatalf("ApplyRuleDocument err:%s", err)
+	}
+
+	type testcase struct {
+		name   string
+		i      int64
+		u      uint64
+		n      int64
+		expect bool
+	}
+	cases := []testcase{
+		{"match", math.MaxInt64, math.MaxUint64, 1<<53 + 1, true},
+		{"MaxInt64-1", math.MaxInt64 - 1, math.MaxUint64, 1<<53 + 1, false},
+		{"MaxUint64-1", math.MaxInt64, math.MaxUint64 - 1, 1<<53 + 1, false},
+		{"2^53", math.MaxInt64, math.MaxUint64, 1 << 53, false},
+	}
+	for _, v := range cases {
+		r := &Record{Map: map[interface{}]interface{}{"i": v.i, "u": v.u, "n": v.n}}
+		if ret := cnf.IsMatch(r, time.Now()); ret != v.expect {
+			t.Errorf("%s: mismatch given:%t expect:%t", v.name, ret, v.expect)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"errors"
+	"time"
+)
+
+// Evaluator checks records via Config and returns failures.
+type Evaluator struct {
+	cnf *Config
+	Now func() time.Time // the base of relative time. Default is time.Now.
+}
+
+// NewEvaluator returns Evaluator of cnf. cnf should not be modified after that.
+func NewEvaluator(cnf *Config) *Evaluator {
+	return &Evaluator{cnf: cnf, Now: time.Now}
+}
+
+// Config returns Config of e.
+func (e *Evaluator) Config() *Config {
+	return e.cnf
+}
+
+// Evaluate checks the record which has tag and the timestamp ts.
+//  It returns nil if the record matches all rules.
+func (e *Evaluator) Evaluate(tag string, ts time.Time, record map[interface{}]interface{}) []Failure {
+	return e.EvaluateRecord(&Record{Tag: tag, Time: NewEventTime(ts), Map: record})
+}
+
+// EvaluateRecord checks r. RuleSets of Config are checked if r is selected.
+//  It returns nil if r matches all rules.
+func (e *Evaluator) EvaluateRecord(r *Record) []Failure {
+	if r == nil {
+		return []Failure{{Kind: FailureMissing, Expected: "record", Severity: SeverityError, Err: ErrRecordIsNil}}
+	}
+	now := time.Now()
+	if e.Now != nil {
+		now = e.Now()
+	}
+	return e.check(e.cnf, r, now, nil)
+}
+
+// check checks r via cnf. defaults is the metadata of the RuleSet which rules of cnf belong to.
+func (e *Evaluator) check(cnf *Config, r *Record, now time.Time, defaults *Metadata) []Failure {
+	var ret []Failure
+	fail := func(expected string, keys *Keys, v interface{}, found bool, m *Metadata, err error) {
+		f := NewFailure(expected, keys, v, found, m.Merge(defaults), err)
+		f.Tag = r.Tag
+		ret = append(ret, f)
+	}
+
+	for i := range cnf.Exists {
+		keys := &cnf.Exists[i]
+		if _, ok := keys.GetValueFromRecord(r); !ok {
+			fail("exists "+keys.FlattenKeys, keys, nil, false, existRuleOf(cnf.existRules, i).metadata, nil)
+		}
+	}
+	for i := range cnf.NotExists {
+		keys := &cnf.NotExists[i]
+		if v, ok := keys.GetValueFromRecord(r); ok {
+			fail("not exists "+keys.FlattenKeys, keys, v, true, existRuleOf(cnf.notExistRules, i).metadata, nil)
+		}
+	}
+	for i := range cnf.TypeConditions {
+		tc := &cnf.TypeConditions[i]
+		v, ok := tc.Keys.GetValueFromRecord(r)
+		if !ok {
+			fail(tc.TypeConditionStr, &tc.Keys, nil, false, tc.Metadata, nil)
+			continue
+		}
+		if b, err := tc.match(r, v); err != nil || !b {
+			fail(tc.TypeConditionStr, &tc.Keys, v, true, tc.Metadata, err)
+		}
+	}
+	for i := range cnf.TimeConditions {
+		tc := &cnf.TimeConditions[i]
+		v, ok := tc.Keys.GetValueFromRecord(r)
+		if !ok {
+			fail(tc.TimeConditionStr, &tc.Keys, nil, false, tc.Metadata, nil)
+			continue
+		}
+		cnd, err := tc.Condition.Resolve(r)
+		if err != nil {
+			fail(tc.TimeConditionStr, &tc.Keys, v, true, tc.Metadata, err)
+			continue
+		}
+		if b, err := cnd.IsMatch(v, now); err != nil || !b {
+			fail(tc.TimeConditionStr, &tc.Keys, v, true, tc.Metadata, err)
+		}
+	}
+	for i := range cnf.EventTimeConditions {
+		ec := &cnf.EventTimeConditions[i]
+		if b, err := ec.IsMatch(r, now); err != nil || !b {
+			fail(ec.EventTimeConditionStr, &ec.Keys, r.Time.Time, !errors.Is(err, ErrKeyNotFound), ec.Metadata, err)
+		}
+	}
+	for i := range cnf.RuleSets {
+		rs := &cnf.RuleSets[i]
+		if rs.IsSelected(r, now) {
+			ret = append(ret, e.check(&rs.Config, r, now, rs.Metadata.Merge(defaults))...)
+		}
+	}
+	if cnf.ReportUnclassified && !cnf.IsClassified(r, now) {
+		ret = append(ret, Failure{Kind: FailureConditionFalse, Expected: "classified by a rule set", Tag: r.Tag, Severity: SeverityError})
+	}
+	return ret
+}
@@ -0,0 +1,146 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvaluate(t *testing.T) {
+	d, err := NewRuleDocumentFromJson([]byte(`[
+  {"type":"exists", "key":"log", "id":"log-exists"},
+  {"type":"not_exists", "key":"debug"},
+  {"type":"int", "key":["http","status"], "condition":"<", "value":500, "id":"http-5xx", "severity":"warn"},
+  {"type":"time", "key":"time", "condition":">", "value":"now-1m"},
+  {"type":"ruleset", "name":"login", "owner":"team-auth",
+   "when":[{"type":"str", "key":"event", "condition":"==", "value":"login"}]},
+  {"type":"exists", "key":"user", "ruleset":"login"}
+]`))
+	if err != nil {
+		t.Fatalf("NewRuleDocumentFromJson err:%s", err)
+	}
+	cnf := &Config{}
+	if err := cnf.ApplyRuleDocument(d); err != nil {
+		t.Fatalf("ApplyRuleDocument err:%s", err)
+	}
+	now := time.Date(2021, 4, 1, 12, 0, 0, 0, time.UTC)
+	ev := NewEvaluator(cnf)
+	ev.Now = func() time.Time { return now }
+
+	type result struct {
+		kind     FailureKind
+		ruleID   string
+		severity Severity
+		owner    string
+	}
+	type testcase struct {
+		name   string
+		record map[interface{}]interface{}
+		expect []result
+	}
+
+	valid := func() map[interface{}]interface{} {
+		return map[interface{}]interface{}{
+			"log":  "hello",
+			"http": map[interface{}]interface{}{"status": int64(200)},
+			"time": now.Add(-10 * time.Second).Format(time.RFC3339),
+		}
+	}
+	cases := []testcase{
+		{"valid", valid(), nil},
+		{"missing", map[interface{}]interface{}{"time": now.Format(time.RFC3339)}, []result{
+			{FailureMissing, "log-exists", SeverityError, ""},
+			{FailureMissing, "http-5xx", SeverityWarning, ""},
+		}},
+		{"condition false", func() map[interface{}]interface{} {
+			m := valid()
+			m["debug"] = true
+			m["http"] = map[interface{}]interface{}{"status": int64(503)}
+			m["time"] = now.Add(-time.Hour).Format(time.RFC3339)
+			return m
+		}(), []result{
+			{FailureConditionFalse, "", SeverityError, ""},
+			{FailureConditionFalse, "http-5xx", SeverityWarning, ""},
+			{FailureConditionFalse, "", SeverityError, ""},
+		}},
+		{"type mismatch and parse error", func() map[interface{}]interface{} {
+			m := valid()
+			m["http"] = map[interface{}]interface{}{"status": "200"}
+			m["time"] = "yesterday"
+			return m
+		}(), []result{
+			{FailureTypeMismatch, "http-5xx", SeverityWarning, ""},
+			{FailureParseError, "", SeverityError, ""},
+		}},
+		{"nil", func() map[interface{}]interface{} {
+			m := valid()
+			m["http"] = map[interface{}]interface{}{"status": nil}
+			return m
+		}(), []result{
+			{FailureNil, "http-5xx", SeverityWarning, ""},
+		}},
+		{"ruleset", func() map[interface{}]interface{} {
+			m := valid()
+			m["event"] = "login"
+			return m
+		}(), []result{
+			{FailureMissing, "", SeverityError, "team-auth"},
+		}},
+	}
+
+	for _, v := range cases {
+		ret := ev.Evaluate("app.web", now, v.record)
+		if len(ret) != len(v.expect) {
+			t.Errorf("%s: length mismatch:%v", v.name, ret)
+			continue
+		}
+		for i, f := range ret {
+			e := v.expect[i]
+			owner := ""
+			if f.Metadata != nil {
+				owner = f.Metadata.Owner
+			}
+			if f.Kind != e.kind || f.RuleID != e.ruleID || f.Severity != e.severity || owner != e.owner || f.Tag != "app.web" {
+				t.Errorf("%s: %d mismatch\n given :%s %+v\n expect:%+v", v.name, i, f.Kind, f, e)
+			}
+		}
+	}
+}
+
+func TestEvaluateUnclassified(t *testing.T) {
+	cnf := &Config{ReportUnclassified: true}
+	c, err := NewConfigLineFromJson(`{"name":"login", "when":[{"type":"exists", "key":"user"}]}`)
+	if err != nil {
+		t.Fatalf("NewConfigLineFromJson err:%s", err)
+	}
+	if err := cnf.SetConfigLine(ConfigRuleSetKeyName, c); err != nil {
+		t.Fatalf("SetConfigLine err:%s", err)
+	}
+	ev := NewEvaluator(cnf)
+
+	if ret := ev.Evaluate("app", time.Now(), map[interface{}]interface{}{"user": "a"}); ret != nil {
+		t.Errorf("classified record should match:%v", ret)
+	}
+	ret := ev.Evaluate("app", time.Now(), map[interface{}]interface{}{"log": "a"})
+	if len(ret) != 1 || ret[0].Kind != FailureConditionFalse {
+		t.Errorf("unclassified record should fail:%v", ret)
+	}
+	if ret := ev.EvaluateRecord(nil); len(ret) != 1 || ret[0].Err != ErrRecordIsNil {
+		t.Errorf("nil record should fail:%v", ret)
+	}
+}
@@ -0,0 +1,179 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const ConfigEventTimeKeyName = "event_time"
+
+// EventTime represents the timestamp of a record.
+type EventTime struct {
+	Time time.Time
+	Ext  bool // true if the timestamp is EventTime ext format which has sub-second precision.
+}
+
+// NewEventTime returns EventTime via the timestamp ts of a record.
+//  time.Time is treated as EventTime ext format and a number is treated as epoch seconds.
+//  If ts is unknown type, it returns zero EventTime.
+func NewEventTime(ts interface{}) EventTime {
+	if t, ok := ts.(time.Time); ok {
+		return EventTime{Time: t, Ext: true}
+	}
+	t, err := parseTime(ts, LayoutEpoch, time.UTC)
+	if err != nil {
+		return EventTime{}
+	}
+	return EventTime{Time: t}
+}
+
+// IsZero check if et is zero or epoch.
+func (et EventTime) IsZero() bool {
+	return et.Time.IsZero() || (et.Time.Unix() == 0 && et.Time.Nanosecond() == 0)
+}
+
+func (et EventTime) String() string {
+	if et.Time.IsZero() {
+		return "0"
+	}
+	return et.Time.UTC().Format(time.RFC3339Nano)
+}
+
+// EventTimeCondition represents event_time configuration.
+type EventTimeCondition struct {
+	Keys                  Keys // for CaseNear
+	ccase                 int
+	cond                  *TimeCondition // for CaseEq, CaseNe, CaseGt, CaseGe, CaseLt and CaseLe
+	layout                string         // for CaseNear
+	loc                   *time.Location // for CaseNear
+	tolerance             time.Duration  // for CaseNear
+	EventTimeConditionStr string
+	Metadata              *Metadata // nil if the rule has no metadata.
+}
+
+// IsMatch check if the event time of r matches condition.
+//  now is used as the base of relative time.
+func (c EventTimeCondition) IsMatch(r *Record, now time.Time) (bool, error) {
+	if r == nil {
+		return false, ErrRecordIsNil
+	}
+	et := r.Time
+	switch c.ccase {
+	case CaseNotZero:
+		return !et.IsZero(), nil
+	case CaseSubsecond:
+		return et.Ext, nil
+	case CaseNear:
+		v, ok := c.Keys.GetValueFromRecord(r)
+		if !ok {
+			return false, ErrKeyNotFound
+		}
+		if v == nil {
+			return false, ErrValueIsNil
+		}
+		t, err := parseTime(v, c.layout, c.loc)
+		if err != nil {
+			return false, err
+		}
+		d := et.Time.Sub(t)
+		if d < 0 {
+			d = -d
+		}
+		return d <= c.tolerance, nil
+	}
+	if c.cond == nil {
+		return false, ErrInvalidCondition
+	}
+	cnd, err := c.cond.Resolve(r)
+	if err != nil {
+		return false, err
+	}
+	return cnd.IsMatch(et.Time, now)
+}
+
+func (c EventTimeCondition) String() string {
+	switch c.ccase {
+	case CaseNotZero, CaseSubsecond:
+		return "event time " + IntCase2Str(c.ccase)
+	case CaseNear:
+		return fmt.Sprintf("event time near %s within %s", c.Keys.String(), c.tolerance)
+	}
+	if c.cond == nil {
+		return "event time Invalid"
+	}
+	return "event time " + c.cond.String()
+}
+
+// NewEventTimeCondition returns EventTimeCondition via c.
+//  "not_zero" and "subsecond" need no key and value.
+//  "near" needs the key of the record and the tolerance as value like "1s".
+//  Other conditions are same as key_time.
+func NewEventTimeCondition(c *ConfigLine) (*EventTimeCondition, error) {
+	if c == nil {
+		return nil, errors.New("ConfigLine is nil")
+	}
+	ret := &EventTimeCondition{ccase: Str2IntCase(c.ClCondition)}
+
+	switch ret.ccase {
+	case CaseNotZero, CaseSubsecond:
+	case CaseNear:
+		k, err := convertKeys(c.ClKey)
+		if err != nil {
+			return nil, fmt.Errorf("NewEventTimeCondition:%w", err)
+		}
+		ret.Keys = *k
+		s, ok := c.ClValue.(string)
+		if !ok {
+			return nil, fmt.Errorf("json string convert error type=%T", c.ClValue)
+		}
+		ret.tolerance, err = time.ParseDuration(s)
+		if err != nil || ret.tolerance < 0 {
+			return nil, fmt.Errorf("tolerance parse error:%s", s)
+		}
+		ret.layout = c.ClLayout
+		ret.loc = time.UTC
+		if c.ClTimezone != "" {
+			ret.loc, err = time.LoadLocation(c.ClTimezone)
+			if err != nil {
+				return nil, fmt.Errorf("timezone error:%w", err)
+			}
+		}
+	default:
+		cnd, err := NewTimeCondition(ret.ccase, c.ClValue, c.ClLayout, c.ClTimezone)
+		if err != nil {
+			return nil, fmt.Errorf("NewTimeCondition err:%w", err)
+		}
+		ret.cond = cnd
+	}
+	ret.EventTimeConditionStr = ret.String()
+
+	return ret, nil
+}
+
+// SetEventTimeCondition set event time condition via c.
+func (cnf *Config) SetEventTimeCondition(c *ConfigLine) error {
+	ec, err := NewEventTimeCondition(c)
+	if err != nil {
+		return err
+	}
+	ec.Metadata = c.metadata()
+	cnf.EventTimeConditions = append(cnf.EventTimeConditions, *ec)
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewEventTime(t *testing.T) {
+	base := time.Unix(1609556645, 500000000)
+
+	et := NewEventTime(base)
+	if !et.Ext || !et.Time.Equal(base) {
+		t.Errorf("time.Time mismatch: %+v", et)
+	}
+	et = NewEventTime(uint64(1609556645))
+	if et.Ext || et.Time.Unix() != 1609556645 {
+		t.Errorf("uint64 mismatch: %+v", et)
+	}
+	et = NewEventTime(nil)
+	if !et.IsZero() {
+		t.Errorf("nil should be zero: %+v", et)
+	}
+	et = NewEventTime(uint64(0))
+	if !et.IsZero() {
+		t.Errorf("epoch should be zero: %+v", et)
+	}
+}
+
+func newEventTimeConditionFromJson(t *testing.T, s string) *EventTimeCondition {
+	t.Helper()
+
+	cnfl, err := NewConfigLineFromJson(s)
+	if err != nil {
+		t.Fatalf("NewConfigLine err:%s", err)
+	}
+	c, err := NewEventTimeCondition(cnfl)
+	if err != nil {
+		t.Fatalf("NewEventTimeCondition err:%s", err)
+	}
+	return c
+}
+
+func TestMatchEventTime(t *testing.T) {
+	now := time.Unix(1609556645, 0)
+	record := map[interface{}]interface{}{
+		"time":  "2021-01-02T03:04:05.2Z",
+		"epoch": uint64(1609556600),
+	}
+
+	type testcase struct {
+		name   string
+		json   string
+		et     EventTime
+		expect bool
+	}
+	cases := []testcase{
+		{"window ok", `{"condition":">=", "value":"now-10m"}`, EventTime{Time: now.Add(-time.Minute)}, true},
+		{"window ng", `{"condition":">=", "value":"now-10m"}`, EventTime{Time: now.Add(-time.Hour)}, false},
+		{"not_zero ok", `{"condition":"not_zero"}`, EventTime{Time: now}, true},
+		{"not_zero zero", `{"condition":"not_zero"}`, EventTime{}, false},
+		{"not_zero epoch", `{"condition":"not_zero"}`, EventTime{Time: time.Unix(0, 0), Ext: true}, false},
+		{"subsecond ok", `{"condition":"subsecond"}`, EventTime{Time: now, Ext: true}, true},
+		{"subsecond ng", `{"condition":"subsecond"}`, EventTime{Time: now}, false},
+		{"near ok", `{"condition":"near", "key":"time", "value":"500ms"}`, EventTime{Time: now}, true},
+		{"near ng", `{"condition":"near", "key":"time", "value":"100ms"}`, EventTime{Time: now}, false},
+		{"near epoch", `{"condition":"near", "key":"epoch", "value":"1m", "layout":"epoch"}`, EventTime{Time: now}, true},
+	}
+
+	for i, v := range cases {
+		c := newEventTimeConditionFromJson(t, v.json)
+		b, err := c.IsMatch(&Record{Time: v.et, Map: record}, now)
+		if err != nil {
+			t.Errorf("%d:%s IsMatch err:%s", i, v.name, err)
+		} else if b != v.expect {
+			t.Errorf("%d:%s mismatch\n given :%t\n expect:%t", i, v.name, b, v.expect)
+		}
+	}
+
+	c := newEventTimeConditionFromJson(t, `{"condition":"near", "key":"missing", "value":"1s"}`)
+	_, err := c.IsMatch(&Record{Time: EventTime{Time: now}, Map: record}, now)
+	if err == nil {
+		t.Errorf("missing key should be error")
+	}
+}
+
+func TestNewEventTimeConditionError(t *testing.T) {
+	cases := []string{
+		`{"condition":"near", "value":"1s"}`,
+		`{"condition":"near", "key":"time"}`,
+		`{"condition":"near", "key":"time", "value":"-1s"}`,
+		`{"condition":"contains", "value":"now"}`,
+		`{"condition":">=", "value":"yesterday"}`,
+	}
+	for i, v := range cases {
+		cnfl, err := NewConfigLineFromJson(v)
+		if err != nil {
+			t.Fatalf("%d:NewConfigLine err:%s", i, err)
+		}
+		_, err = NewEventTimeCondition(cnfl)
+		if err == nil {
+			t.Errorf("%d:%s should be error", i, v)
+		}
+	}
+}
+
+func TestSetEventTimeCondition(t *testing.T) {
+	cnf := &Config{}
+	cnfl, err := NewConfigLineFromJson(`{"condition":"near", "key":["log","time"], "value":"1s"}`)
+	if err != nil {
+		t.Fatalf("NewConfigLine err:%s", err)
+	}
+	err = cnf.SetEventTimeCondition(cnfl)
+	if err != nil {
+		t.Fatalf("SetEventTimeCondition err:%s", err)
+	}
+	if len(cnf.EventTimeConditions) != 1 {
+		t.Fatalf("len(cnf.EventTimeConditions)=%d != 1", len(cnf.EventTimeConditions))
+	}
+	expect := `event time near "log"->"time" within 1s`
+	if cnf.EventTimeConditions[0].EventTimeConditionStr != expect {
+		t.Errorf("mismatch:\n given :%s\n expect:%s", cnf.EventTimeConditions[0].EventTimeConditionStr, expect)
+	}
+}
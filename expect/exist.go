@@ -24,6 +24,30 @@ import (
 type Keys struct {
 	Keys        []string
 	FlattenKeys string
+	pseudo      bool // Keys[0] is a pseudo-field like "$TAG"
+}
+
+// existRule holds the metadata and the configuration name of a rule of Exists or NotExists.
+type existRule struct {
+	metadata *Metadata // nil if the rule has no metadata.
+	param    string    // see ConfigLine.ClParam
+}
+
+// existRuleOf returns the i-th rule of rules.
+//  It returns the zero value if Exists or NotExists is set without SetExist.
+func existRuleOf(rules []existRule, i int) existRule {
+	if i < len(rules) {
+		return rules[i]
+	}
+	return existRule{}
+}
+
+// appendExistRule appends rule as the n-th rule of rules.
+func appendExistRule(rules []existRule, n int, rule existRule) []existRule {
+	for len(rules) < n {
+		rules = append(rules, existRule{})
+	}
+	return append(rules[:n], rule)
 }
 
 // String implements fmt.Stringer.
@@ -63,9 +87,22 @@ func (k Keys) GetValueFromMap(m map[interface{}]interface{}) (interface{}, bool)
 	return ret, true
 }
 
+// GetValueFromRecord returns the value from record r.
+//  If k is a pseudo-field, it returns the tag or the timestamp of r.
+//  If the value is not found, it returns nil, false.
+func (k Keys) GetValueFromRecord(r *Record) (interface{}, bool) {
+	if r == nil {
+		return nil, false
+	}
+	if k.pseudo {
+		return r.pseudoValue(k.Keys[0])
+	}
+	return k.GetValueFromMap(r.Map)
+}
+
 // Compare compares k and ks.
 func (k Keys) Compare(ks Keys) bool {
-	if len(k.Keys) != len(ks.Keys) || len(k.Keys) == 0 {
+	if len(k.Keys) != len(ks.Keys) || len(k.Keys) == 0 || k.pseudo != ks.pseudo {
 		return false
 	}
 	for i, key := range k.Keys {
@@ -88,15 +125,18 @@ func (cnf *Config) SetExist(c *ConfigLine, isExist bool) error {
 		return fmt.Errorf("SetExists:%w", err)
 	}
 
+	rule := existRule{metadata: c.metadata(), param: c.ClParam}
 	if isExist {
 		if cnf.HasExistKeys(k) {
 			return errors.New("already exist")
 		}
+		cnf.existRules = appendExistRule(cnf.existRules, len(cnf.Exists), rule)
 		cnf.Exists = append(cnf.Exists, *k)
 	} else {
 		if cnf.HasNotExistKeys(k) {
 			return errors.New("already exist")
 		}
+		cnf.notExistRules = appendExistRule(cnf.notExistRules, len(cnf.NotExists), rule)
 		cnf.NotExists = append(cnf.NotExists, *k)
 	}
 	return nil
@@ -18,6 +18,7 @@ package expect
 
 import (
 	"testing"
+	"time"
 )
 
 func TestGetValueFromMap(t *testing.T) {
@@ -209,6 +210,26 @@ func TestSetNotExistKeysTwice(t *testing.T) {
 	}
 }
 
+func TestSetExistMetadata(t *testing.T) {
+	// Exists can be set without SetExist.
+	cnf := &Config{Exists: []Keys{{Keys: []string{"a"}, FlattenKeys: `"a"`}}}
+	cnfl, err := NewConfigLineFromJson(`{"key":"b", "id":"b-exists"}`)
+	if err != nil {
+		t.Fatalf("NewConfigLineFromJson err:%s", err)
+	}
+	if err := cnf.SetExist(cnfl, true); err != nil {
+		t.Fatalf("SetExist err:%s", err)
+	}
+
+	failures := NewEvaluator(cnf).Evaluate("app", time.Now(), map[interface{}]interface{}{})
+	if len(failures) != 2 {
+		t.Fatalf("length mismatch:%+v", failures)
+	}
+	if failures[0].RuleID != "" || failures[1].RuleID != "b-exists" {
+		t.Errorf("id mismatch:%q %q", failures[0].RuleID, failures[1].RuleID)
+	}
+}
+
 func TestKeyCompare(t *testing.T) {
 	type testcase struct {
 		name   string
@@ -0,0 +1,186 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package expecttest provides helpers to use rules of expect as assertions of Go tests.
+//  e.g. a Go filter plugin can check records which it emits.
+package expecttest
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/fluent/fluent-bit-go/output"
+	"github.com/nokute78/fluentbit-plugin-out-expect/expect"
+)
+
+// TB is the subset of testing.TB which helpers use.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	FailNow()
+}
+
+// Now is the base of relative time of rules. Default is time.Now.
+var Now = time.Now
+
+// NewConfig returns Config of rules. It fails t if rules are invalid.
+//  rules is rules of text like the value of "expect" or Json rules like a rules file.
+func NewConfig(t TB, rules string) *expect.Config {
+	t.Helper()
+	cnf, err := parseConfig(rules)
+	if err != nil {
+		t.Errorf("expecttest: rules error=%s", err)
+		t.FailNow()
+	}
+	return cnf
+}
+
+func parseConfig(rules string) (*expect.Config, error) {
+	var d *expect.RuleDocument
+	s := strings.TrimSpace(rules)
+	if strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{") {
+		doc, err := expect.NewRuleDocumentFromJson([]byte(s))
+		if err != nil {
+			return nil, err
+		}
+		d = doc
+	} else {
+		lines, err := expect.ParseRules(s)
+		if err != nil {
+			return nil, err
+		}
+		d = &expect.RuleDocument{Rules: lines}
+	}
+	cnf := &expect.Config{}
+	if err := cnf.ApplyRuleDocument(d); err != nil {
+		return nil, err
+	}
+	if err := cnf.Validate(); err != nil {
+		return nil, err
+	}
+	return cnf, nil
+}
+
+// AssertRecords checks records via cnf. Each failure is reported by t.Errorf.
+//  It returns true if all records match rules.
+func AssertRecords(t TB, cnf *expect.Config, records []map[interface{}]interface{}) bool {
+	t.Helper()
+	return AssertTagRecords(t, cnf, "", records)
+}
+
+// AssertTagRecords is same as AssertRecords but records have tag.
+func AssertTagRecords(t TB, cnf *expect.Config, tag string, records []map[interface{}]interface{}) bool {
+	t.Helper()
+	ev := expect.NewEvaluator(cnf)
+	ev.Now = Now
+	ts := Now()
+	ret := true
+	for i, record := range records {
+		for _, f := range ev.Evaluate(tag, ts, record) {
+			f.RecordIndex = i
+			t.Errorf("%s", Message(f))
+			ret = false
+		}
+	}
+	return ret
+}
+
+// AssertChunk checks records of msgpack chunk like the output of a filter plugin.
+//  Each record is an array of the timestamp and the map.
+func AssertChunk(t TB, cnf *expect.Config, tag string, chunk []byte) bool {
+	t.Helper()
+	if len(chunk) == 0 {
+		t.Errorf("expecttest: chunk is empty")
+		return false
+	}
+	ev := expect.NewEvaluator(cnf)
+	ev.Now = Now
+	dec := output.NewDecoder(unsafe.Pointer(&chunk[0]), len(chunk))
+	ret := true
+	for i := 0; ; i++ {
+		code, ts, record := output.GetRecord(dec)
+		if code != 0 {
+			break
+		}
+		if ft, ok := ts.(output.FLBTime); ok {
+			ts = ft.Time
+		}
+		r := &expect.Record{Tag: tag, Time: expect.NewEventTime(ts), Map: record}
+		for _, f := range ev.EvaluateRecord(r) {
+			f.RecordIndex = i
+			t.Errorf("%s", Message(f))
+			ret = false
+		}
+	}
+	return ret
+}
+
+// RequireRecord checks record via rules and stops the test if it fails.
+//  rules is same as NewConfig.
+func RequireRecord(t TB, rules string, record map[interface{}]interface{}) {
+	t.Helper()
+	cnf := NewConfig(t, rules)
+	if !AssertRecords(t, cnf, []map[interface{}]interface{}{record}) {
+		t.FailNow()
+	}
+}
+
+// Message returns the message of f for test reports. e.g.
+//  record[1] key="http"->"status" kind=condition_false
+//      expect: "http"->"status" < 500
+//      actual: 503 (int64)
+func Message(f expect.Failure) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "record[%d]", f.RecordIndex)
+	if f.Tag != "" {
+		fmt.Fprintf(&b, " tag=%s", f.Tag)
+	}
+	if len(f.Keys) > 0 {
+		fmt.Fprintf(&b, " key=%s", expect.Keys{Keys: f.Keys}.String())
+	}
+	fmt.Fprintf(&b, " kind=%s\n", f.Kind)
+	fmt.Fprintf(&b, "    expect: %s\n", f.Expected)
+	fmt.Fprintf(&b, "    actual: %s", actual(f))
+	if f.Err != nil && f.Err != expect.ErrKeyNotFound && f.Err != expect.ErrValueIsNil {
+		fmt.Fprintf(&b, "\n    error : %s", f.Err)
+	}
+	if !f.Metadata.IsEmpty() {
+		fmt.Fprintf(&b, "\n    rule  : %s", f.Metadata)
+	}
+	return b.String()
+}
+
+// actual returns the actual value of f with its type.
+func actual(f expect.Failure) string {
+	switch {
+	case f.Kind == expect.FailureMissing:
+		return "<not found>"
+	case f.Kind == expect.FailureNil:
+		return "nil"
+	case f.ActualType == "":
+		return "<none>"
+	}
+	switch v := f.Actual.(type) {
+	case string:
+		return fmt.Sprintf("%q (%s)", v, f.ActualType)
+	case []byte:
+		return fmt.Sprintf("%q (%s)", v, f.ActualType)
+	}
+	return fmt.Sprintf("%v (%s)", f.Actual, f.ActualType)
+}
@@ -0,0 +1,162 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expecttest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTB records messages instead of failing the test.
+type fakeTB struct {
+	errors []string
+	failed bool
+}
+
+func (t *fakeTB) Helper() {
+}
+
+func (t *fakeTB) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+// FailNow stops the goroutine like testing.T.
+func (t *fakeTB) FailNow() {
+	t.failed = true
+	panic(t)
+}
+
+// run calls f with t and recovers FailNow.
+func (t *fakeTB) run(f func(t *fakeTB)) {
+	defer func() {
+		if r := recover(); r != nil && r != t {
+			panic(r)
+		}
+	}()
+	f(t)
+}
+
+func TestAssertRecords(t *testing.T) {
+	cnf := NewConfig(t, `
+$log exists
+$http.status int < 500 id http-5xx owner team-web
+`)
+	records := []map[interface{}]interface{}{
+		{"log": "a", "http": map[interface{}]interface{}{"status": int64(200)}},
+		{"log": "b", "http": map[interface{}]interface{}{"status": int64(503)}},
+		{"http": map[interface{}]interface{}{"status": "ok"}},
+	}
+
+	ft := &fakeTB{}
+	if AssertRecords(ft, cnf, records) {
+		t.Errorf("expect false")
+	}
+	expect := []string{
+		`record[1] key="http"->"status" kind=condition_false
+    expect: "http"->"status" < 500
+    actual: 503 (int64)
+    rule  : id=http-5xx owner=team-web`,
+		`record[2] key="log" kind=missing
+    expect: exists "log"
+    actual: <not found>`,
+		`record[2] key="http"->"status" kind=type_mismatch
+    expect: "http"->"status" < 500
+    actual: "ok" (string)
+    error : can not cast: type=2 v=ok
+    rule  : id=http-5xx owner=team-web`,
+	}
+	if len(ft.errors) != len(expect) {
+		t.Fatalf("length mismatch:\n given :%q\n expect:%q", ft.errors, expect)
+	}
+	for i, v := range ft.errors {
+		if v != expect[i] {
+			t.Errorf("%d mismatch:\n given :%s\n expect:%s", i, v, expect[i])
+		}
+	}
+	if ft.failed {
+		t.Errorf("AssertRecords should not stop the test")
+	}
+}
+
+func TestRequireRecord(t *testing.T) {
+	type testcase struct {
+		name   string
+		rules  string
+		record map[interface{}]interface{}
+		failed bool
+		errors int
+	}
+
+	cases := []testcase{
+		{"pass", `$level str == info`, map[interface{}]interface{}{"level": []byte("info")}, false, 0},
+		{"fail", `$level str == info`, map[interface{}]interface{}{"level": "warn"}, true, 1},
+		{"json", `[{"type":"exists", "key":"level"}, {"type":"not_exists", "key":"debug"}]`, map[interface{}]interface{}{"debug": true}, true, 2},
+		{"invalid rules", `$level str >> info`, map[interface{}]interface{}{"level": "info"}, true, 1},
+	}
+
+	for _, v := range cases {
+		ft := &fakeTB{}
+		ft.run(func(ft *fakeTB) {
+			RequireRecord(ft, v.rules, v.record)
+		})
+		if ft.failed != v.failed {
+			t.Errorf("%s: failed mismatch given=%t expect=%t", v.name, ft.failed, v.failed)
+		}
+		if len(ft.errors) != v.errors {
+			t.Errorf("%s: errors mismatch:\n given :%q\n expect:%d", v.name, ft.errors, v.errors)
+		}
+	}
+}
+
+func TestAssertChunk(t *testing.T) {
+	cnf := NewConfig(t, `[
+  {"type":"int", "key":"code", "condition":"==", "value":0},
+  {"type":"str", "key":"$TAG", "condition":"==", "value":"app.test"},
+  {"type":"event_time", "condition":">", "value":"2021-01-01T00:00:00Z"}
+]`)
+	// [1617278400, {"code": 0}], [1617278400, {"code": 1}]
+	record := func(code byte) []byte {
+		return []byte{0x92, 0xce, 0x60, 0x65, 0xb5, 0xc0, 0x81, 0xa4, 'c', 'o', 'd', 'e', code}
+	}
+	chunk := append(record(0), record(1)...)
+
+	ft := &fakeTB{}
+	if AssertChunk(ft, cnf, "app.test", chunk) {
+		t.Errorf("expect false")
+	}
+	if len(ft.errors) != 1 || !strings.HasPrefix(ft.errors[0], `record[1] tag=app.test key="code" kind=condition_false`) {
+		t.Errorf("mismatch:%q", ft.errors)
+	}
+
+	ft = &fakeTB{}
+	if AssertChunk(ft, cnf, "app.other", record(0)) || len(ft.errors) != 1 {
+		t.Errorf("mismatch:%q", ft.errors)
+	}
+}
+
+func TestNow(t *testing.T) {
+	defer func(f func() time.Time) { Now = f }(Now)
+	Now = func() time.Time { return time.Date(2021, 4, 1, 12, 0, 0, 0, time.UTC) }
+
+	cnf := NewConfig(t, `$time time > now-1m layout 2006-01-02T15:04:05Z07:00`)
+	record := map[interface{}]interface{}{"time": "2021-04-01T11:59:30Z"}
+	if !AssertRecords(t, cnf, []map[interface{}]interface{}{record}) {
+		t.Errorf("expect true")
+	}
+}
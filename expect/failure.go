@@ -0,0 +1,193 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Errors of matching a record. Errors of IsMatch and Resolve wrap them.
+var (
+	ErrKeyNotFound  = errors.New("key not found")
+	ErrValueIsNil   = errors.New("value is nil")
+	ErrTypeMismatch = errors.New("can not cast")
+	ErrParse        = errors.New("parse error")
+	ErrUnresolved   = errors.New("unresolved value")
+	ErrRecordIsNil  = errors.New("record is nil")
+)
+
+// FailureKind represents why a rule failed.
+type FailureKind int
+
+const (
+	FailureMissing        FailureKind = iota // the key is not found.
+	FailureTypeMismatch                      // the value can not be compared with the condition.
+	FailureNil                               // the value is nil.
+	FailureConditionFalse                    // the value doesn't match the condition.
+	FailureParseError                        // the value or the pseudo-field can not be parsed.
+)
+
+func (k FailureKind) String() string {
+	switch k {
+	case FailureMissing:
+		return "missing"
+	case FailureTypeMismatch:
+		return "type_mismatch"
+	case FailureNil:
+		return "nil"
+	case FailureConditionFalse:
+		return "condition_false"
+	case FailureParseError:
+		return "parse_error"
+	}
+	return "unknown"
+}
+
+// FailureKindOf returns FailureKind of err which IsMatch or Resolve returns.
+func FailureKindOf(err error) FailureKind {
+	switch {
+	case err == nil:
+		return FailureConditionFalse
+	case errors.Is(err, ErrKeyNotFound):
+		return FailureMissing
+	case errors.Is(err, ErrValueIsNil):
+		return FailureNil
+	case errors.Is(err, ErrParse):
+		return FailureParseError
+	}
+	return FailureTypeMismatch
+}
+
+// Failure represents a rule which a record doesn't match.
+type Failure struct {
+	Kind        FailureKind
+	RuleID      string      // "id" of the rule. blank if the rule has no id.
+	Keys        []string    // the key path. nil if the rule has no key like "event_time".
+	Expected    string      // the rule like `"status" < 500` or `exists "status"`.
+	Actual      interface{} // the value of the key. nil if it is not found.
+	ActualType  string      // Go type of Actual like "int64". blank if Actual is not found.
+	RecordIndex int         // the index of the record in the chunk.
+	Tag         string
+	Severity    Severity
+	Metadata    *Metadata // nil if the rule has no metadata.
+	Err         error     // the cause. nil if Kind is FailureConditionFalse.
+}
+
+// NewFailure returns Failure of the rule which has m.
+//  err is the error of matching. The kind is FailureKindOf(err).
+func NewFailure(expected string, keys *Keys, v interface{}, found bool, m *Metadata, err error) Failure {
+	ret := Failure{Kind: FailureKindOf(err), Expected: expected, Severity: m.Level(), Metadata: m, Err: err}
+	if !found {
+		ret.Kind = FailureMissing
+	} else {
+		ret.Actual = v
+		ret.ActualType = fmt.Sprintf("%T", v)
+	}
+	if keys != nil && len(keys.Keys) > 0 {
+		ret.Keys = keys.Keys
+	}
+	if m != nil {
+		ret.RuleID = m.ID
+	}
+	return ret
+}
+
+// Error implements error. e.g.
+//  Error. expect: value 503 of "status" < 500 (id=http-5xx owner=team-web)
+func (f Failure) Error() string {
+	var s string
+	switch f.Kind {
+	case FailureMissing:
+		s = "Key not found. expect: " + f.Expected
+	case FailureNil:
+		s = "Value is nil. expect: " + f.Expected
+	case FailureTypeMismatch:
+		s = "Type mismatch. expect: value " + i2str(f.Actual) + "(" + f.ActualType + ") of " + f.Expected
+	case FailureParseError:
+		s = "Parse error. expect: value " + i2str(f.Actual) + " of " + f.Expected
+	default:
+		if f.ActualType == "" {
+			s = "Error. expect: " + f.Expected
+		} else {
+			s = "Error. expect: value " + i2str(f.Actual) + " of " + f.Expected
+		}
+	}
+	if f.Err != nil && f.Err != ErrKeyNotFound && f.Err != ErrValueIsNil {
+		s += " " + f.Err.Error()
+	}
+	if !f.Metadata.IsEmpty() {
+		s += " (" + f.Metadata.String() + ")"
+	}
+	return s
+}
+
+// Unwrap returns the cause of f.
+func (f Failure) Unwrap() error {
+	return f.Err
+}
+
+// i2str returns the string of v for reports.
+func i2str(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return v.(string)
+	case []byte:
+		return string(v.([]byte))
+	case bool:
+		b := v.(bool)
+		return strconv.FormatBool(b)
+	case int:
+		i := v.(int)
+		return strconv.FormatInt(int64(i), 10)
+	case int8:
+		i := v.(int8)
+		return strconv.FormatInt(int64(i), 10)
+	case int16:
+		i := v.(int16)
+		return strconv.FormatInt(int64(i), 10)
+	case int32:
+		i := v.(int32)
+		return strconv.FormatInt(int64(i), 10)
+	case int64:
+		i := v.(int64)
+		return strconv.FormatInt(i, 10)
+	case uint:
+		i := v.(uint)
+		return strconv.FormatUint(uint64(i), 10)
+	case uint8:
+		i := v.(uint8)
+		return strconv.FormatUint(uint64(i), 10)
+	case uint16:
+		i := v.(uint16)
+		return strconv.FormatUint(uint64(i), 10)
+	case uint32:
+		i := v.(uint32)
+		return strconv.FormatUint(uint64(i), 10)
+	case uint64:
+		i := v.(uint64)
+		return strconv.FormatUint(i, 10)
+	case float32:
+		f := v.(float32)
+		return strconv.FormatFloat(float64(f), 'f', -1, 32)
+	case float64:
+		f := v.(float64)
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,125 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"errors"
+	"go/types"
+	"testing"
+	"time"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	intCnd, err := NewIntCondition(CaseEq, 1)
+	if err != nil {
+		t.Fatalf("NewIntCondition err:%s", err)
+	}
+	refCnd, err := NewRefCondition(types.Int, CaseEq, "$TAG[1]")
+	if err != nil {
+		t.Fatalf("NewRefCondition err:%s", err)
+	}
+	timeCnd, err := NewTimeCondition(CaseGt, "now-1m", "", "")
+	if err != nil {
+		t.Fatalf("NewTimeCondition err:%s", err)
+	}
+	r := &Record{Tag: "app.x", Map: map[interface{}]interface{}{}}
+
+	type testcase struct {
+		name   string
+		err    error
+		expect error
+		kind   FailureKind
+	}
+
+	_, nilErr := intCnd.IsMatch(nil)
+	_, castErr := intCnd.IsMatch("1")
+	_, unresolvedErr := refCnd.IsMatch(1)
+	_, resolveErr := refCnd.Resolve(r)
+	_, notFoundErr := refCnd.Resolve(&Record{Tag: "app"})
+	_, parseErr := timeCnd.IsMatch("yesterday", time.Now())
+	_, timeCastErr := timeCnd.IsMatch(true, time.Now())
+
+	cases := []testcase{
+		{"nil", nilErr, ErrValueIsNil, FailureNil},
+		{"cast", castErr, ErrTypeMismatch, FailureTypeMismatch},
+		{"unresolved", unresolvedErr, ErrUnresolved, FailureTypeMismatch},
+		{"resolve parse", resolveErr, ErrParse, FailureParseError},
+		{"resolve not found", notFoundErr, ErrKeyNotFound, FailureMissing},
+		{"time parse", parseErr, ErrParse, FailureParseError},
+		{"time cast", timeCastErr, ErrTypeMismatch, FailureTypeMismatch},
+	}
+
+	for _, v := range cases {
+		if !errors.Is(v.err, v.expect) {
+			t.Errorf("%s: error mismatch\n given :%v\n expect:%v", v.name, v.err, v.expect)
+		}
+		if k := FailureKindOf(v.err); k != v.kind {
+			t.Errorf("%s: kind mismatch given:%s expect:%s", v.name, k, v.kind)
+		}
+	}
+}
+
+func TestNewFailure(t *testing.T) {
+	k, err := convertKeys([]interface{}{"http", "status"})
+	if err != nil {
+		t.Fatalf("convertKeys err:%s", err)
+	}
+	m := &Metadata{ID: "http-5xx", Owner: "team-web", Severity: "warn"}
+
+	type testcase struct {
+		name    string
+		v       interface{}
+		found   bool
+		m       *Metadata
+		err     error
+		expect  Failure
+		message string
+	}
+
+	cases := []testcase{
+		{"condition false", int64(503), true, m, nil,
+			Failure{Kind: FailureConditionFalse, RuleID: "http-5xx", Keys: []string{"http", "status"}, Expected: `"http"->"status" < 500`,
+				Actual: int64(503), ActualType: "int64", Severity: SeverityWarning, Metadata: m},
+			`Error. expect: value 503 of "http"->"status" < 500 (id=http-5xx severity=warn owner=team-web)`},
+		{"missing", nil, false, nil, nil,
+			Failure{Kind: FailureMissing, Keys: []string{"http", "status"}, Expected: `"http"->"status" < 500`, Severity: SeverityError},
+			`Key not found. expect: "http"->"status" < 500`},
+		{"nil", nil, true, nil, ErrValueIsNil,
+			Failure{Kind: FailureNil, Keys: []string{"http", "status"}, Expected: `"http"->"status" < 500`, ActualType: "<nil>",
+				Severity: SeverityError, Err: ErrValueIsNil},
+			`Value is nil. expect: "http"->"status" < 500`},
+		{"type mismatch", "503", true, nil, ErrTypeMismatch,
+			Failure{Kind: FailureTypeMismatch, Keys: []string{"http", "status"}, Expected: `"http"->"status" < 500`, Actual: "503",
+				ActualType: "string", Severity: SeverityError, Err: ErrTypeMismatch},
+			`Type mismatch. expect: value 503(string) of "http"->"status" < 500 can not cast`},
+	}
+
+	for _, v := range cases {
+		f := NewFailure(`"http"->"status" < 500`, k, v.v, v.found, v.m, v.err)
+		if f.Kind != v.expect.Kind || f.RuleID != v.expect.RuleID || f.Expected != v.expect.Expected ||
+			f.Actual != v.expect.Actual || f.ActualType != v.expect.ActualType || f.Severity != v.expect.Severity ||
+			f.Metadata != v.expect.Metadata || f.Err != v.expect.Err || len(f.Keys) != len(v.expect.Keys) {
+			t.Errorf("%s: mismatch\n given :%+v\n expect:%+v", v.name, f, v.expect)
+		}
+		if f.Error() != v.message {
+			t.Errorf("%s: message mismatch\n given :%s\n expect:%s", v.name, f.Error(), v.message)
+		}
+		if v.err != nil && !errors.Is(f, v.err) {
+			t.Errorf("%s: Failure should wrap %v", v.name, v.err)
+		}
+	}
+}
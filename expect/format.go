@@ -0,0 +1,209 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go/types"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var ErrUnknownFormat = errors.New("Unknown format")
+
+const ConfigFormatKeyName = "key_format"
+
+var (
+	uuidRegexp   = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	semverRegexp = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+		`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+		`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+)
+
+// formatValidators holds built-in validators of key_format.
+var formatValidators = map[string]func(string) bool{
+	"uuid":         isUUID,
+	"ipv4":         isIPv4,
+	"ipv6":         isIPv6,
+	"cidr":         isCIDR,
+	"hostname":     isHostname,
+	"email":        isEmail,
+	"uri":          isURI,
+	"rfc3339":      isRFC3339,
+	"iso8601_date": isISO8601Date,
+	"hex":          isHex,
+	"base64":       isBase64,
+	"mac":          isMAC,
+	"semver":       isSemver,
+}
+
+func isUUID(s string) bool {
+	return uuidRegexp.MatchString(s)
+}
+
+func isIPv4(s string) bool {
+	ip := net.ParseIP(s)
+	return ip != nil && ip.To4() != nil && !strings.Contains(s, ":")
+}
+
+func isIPv6(s string) bool {
+	return net.ParseIP(s) != nil && strings.Contains(s, ":")
+}
+
+func isCIDR(s string) bool {
+	_, _, err := net.ParseCIDR(s)
+	return err == nil
+}
+
+// isHostname checks s based on RFC 1123.
+//  A trailing dot is allowed.
+func isHostname(s string) bool {
+	s = strings.TrimSuffix(s, ".")
+	if len(s) == 0 || len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return false
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') && r != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isEmail checks if s is a bare address like "user@example.com".
+//  The form "Name <user@example.com>" is not allowed.
+func isEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s {
+		return false
+	}
+	i := strings.LastIndex(s, "@")
+	return i > 0 && isHostname(s[i+1:])
+}
+
+// isURI checks if s is an absolute URI which has a scheme.
+func isURI(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" {
+		return false
+	}
+	return u.Host != "" || u.Opaque != "" || u.Path != ""
+}
+
+func isRFC3339(s string) bool {
+	_, err := time.Parse(time.RFC3339, s)
+	return err == nil
+}
+
+func isISO8601Date(s string) bool {
+	_, err := time.Parse("2006-01-02", s)
+	return err == nil
+}
+
+func isHex(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= '0' && r <= '9') && !(r >= 'a' && r <= 'f') && !(r >= 'A' && r <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func isBase64(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	_, err := base64.StdEncoding.DecodeString(s)
+	return err == nil
+}
+
+func isMAC(s string) bool {
+	_, err := net.ParseMAC(s)
+	return err == nil
+}
+
+func isSemver(s string) bool {
+	return semverRegexp.MatchString(s)
+}
+
+// isFormat check if s is formatted as format f.
+func isFormat(f string, s string) bool {
+	validator, ok := formatValidators[f]
+	if !ok {
+		return false
+	}
+	return validator(s)
+}
+
+// NewFormatCondition returns Condition c of format f.
+//  c must be CaseFormat or CaseNotFormat.
+func NewFormatCondition(c int, f string) (*Condition, error) {
+	if c != CaseFormat && c != CaseNotFormat {
+		return nil, ErrInvalidCondition
+	}
+	if _, ok := formatValidators[f]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, f)
+	}
+	ret := &Condition{ctype: types.String, ccase: c, cvalue: f}
+
+	return ret, nil
+}
+
+// SetFormatCondition set format condition via c.
+//  If condition of c is omitted, it is treated as "format".
+func (cnf *Config) SetFormatCondition(c *ConfigLine) error {
+	if c == nil {
+		return errors.New("ConfigLine is nil")
+	}
+	k, err := convertKeys(c.ClKey)
+	if err != nil {
+		return fmt.Errorf("SetFormatCondition:%w", err)
+	}
+	f, ok := c.ClValue.(string)
+	if !ok {
+		return fmt.Errorf("json string convert error type=%T", c.ClValue)
+	}
+	cs := c.ClCondition
+	if cs == "" {
+		cs = "format"
+	}
+	cnd, err := NewFormatCondition(Str2IntCase(cs), f)
+	if err != nil {
+		return fmt.Errorf("NewFormatCondition err:%w", err)
+	}
+	tc := &TypeCondition{Keys: *k, Condition: *cnd, Metadata: c.metadata(), param: c.ClParam}
+	tc.TypeConditionStr = tc.String()
+	cnf.TypeConditions = append(cnf.TypeConditions, *tc)
+	return nil
+}
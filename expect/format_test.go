@@ -0,0 +1,158 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsFormat(t *testing.T) {
+	type testcase struct {
+		format string
+		input  string
+		expect bool
+	}
+
+	cases := []testcase{
+		{"uuid", "123e4567-e89b-12d3-a456-426614174000", true},
+		{"uuid", "123E4567-E89B-12D3-A456-426614174000", true},
+		{"uuid", "123e4567e89b12d3a456426614174000", false},
+		{"uuid", "123e4567-e89b-12d3-a456-42661417400z", false},
+		{"ipv4", "192.168.0.1", true},
+		{"ipv4", "256.0.0.1", false},
+		{"ipv4", "::ffff:192.168.0.1", false},
+		{"ipv6", "2001:db8::1", true},
+		{"ipv6", "::ffff:192.168.0.1", true},
+		{"ipv6", "192.168.0.1", false},
+		{"cidr", "10.0.0.0/8", true},
+		{"cidr", "2001:db8::/32", true},
+		{"cidr", "10.0.0.0", false},
+		{"hostname", "example.com", true},
+		{"hostname", "localhost", true},
+		{"hostname", "example.com.", true},
+		{"hostname", "-example.com", false},
+		{"hostname", "exa_mple.com", false},
+		{"hostname", "example..com", false},
+		{"email", "taro@example.com", true},
+		{"email", "Taro <taro@example.com>", false},
+		{"email", "taro@", false},
+		{"email", "taro.example.com", false},
+		{"uri", "https://example.com/path?q=1", true},
+		{"uri", "mailto:taro@example.com", true},
+		{"uri", "/relative/path", false},
+		{"uri", "example.com", false},
+		{"rfc3339", "2021-01-02T15:04:05Z", true},
+		{"rfc3339", "2021-01-02T15:04:05.123+09:00", true},
+		{"rfc3339", "2021-01-02 15:04:05", false},
+		{"iso8601_date", "2021-01-02", true},
+		{"iso8601_date", "2021-13-02", false},
+		{"iso8601_date", "2021/01/02", false},
+		{"hex", "deadBEEF01", true},
+		{"hex", "0xdead", false},
+		{"hex", "", false},
+		{"base64", "aGVsbG8=", true},
+		{"base64", "aGVsbG8", false},
+		{"base64", "", false},
+		{"mac", "00:1a:2b:3c:4d:5e", true},
+		{"mac", "00-1A-2B-3C-4D-5E", true},
+		{"mac", "00:1a:2b:3c:4d", false},
+		{"semver", "1.2.3", true},
+		{"semver", "1.0.0-alpha.1+build.5", true},
+		{"semver", "v1.2.3", false},
+		{"semver", "1.02.3", false},
+		{"unknown", "hello", false},
+	}
+
+	for i, v := range cases {
+		ret := isFormat(v.format, v.input)
+		if ret != v.expect {
+			t.Errorf("%d:%s %q mismatch:\n given :%t\n expect:%t", i, v.format, v.input, ret, v.expect)
+		}
+	}
+}
+
+func TestNewFormatCondition(t *testing.T) {
+	_, err := NewFormatCondition(CaseFormat, "uuid")
+	if err != nil {
+		t.Errorf("NewFormatCondition err:%s", err)
+	}
+	_, err = NewFormatCondition(CaseEq, "uuid")
+	if err != ErrInvalidCondition {
+		t.Errorf("CaseEq should be ErrInvalidCondition. err=%v", err)
+	}
+	_, err = NewFormatCondition(CaseFormat, "uuuid")
+	if !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("unknown format should be ErrUnknownFormat. err=%v", err)
+	}
+}
+
+func TestMatchFormat(t *testing.T) {
+	c, err := NewFormatCondition(CaseFormat, "ipv4")
+	if err != nil {
+		t.Fatalf("NewFormatCondition err:%s", err)
+	}
+	testMatch(t, c, "127.0.0.1", true)
+	testMatch(t, c, []byte("127.0.0.1"), true)
+	testMatch(t, c, "localhost", false)
+
+	c, err = NewFormatCondition(CaseNotFormat, "ipv4")
+	if err != nil {
+		t.Fatalf("NewFormatCondition err:%s", err)
+	}
+	testMatch(t, c, "127.0.0.1", false)
+	testMatch(t, c, "localhost", true)
+}
+
+func TestSetFormatCondition(t *testing.T) {
+	cnf := &Config{}
+	cnfl, err := NewConfigLineFromJson(`{"key":"id","value":"uuid"}`)
+	if err != nil {
+		t.Fatalf("NewConfigLine err:%s", err)
+	}
+	err = cnf.SetFormatCondition(cnfl)
+	if err != nil {
+		t.Fatalf("SetFormatCondition err:%s", err)
+	}
+	if len(cnf.TypeConditions) != 1 {
+		t.Fatalf("len(cnf.TypeConditions)=%d != 1", len(cnf.TypeConditions))
+	}
+	if cnf.TypeConditions[0].Condition.ccase != CaseFormat {
+		t.Errorf("case mismatch:\n given :%d\n expect :%d", cnf.TypeConditions[0].Condition.ccase, CaseFormat)
+	}
+
+	cnfl, err = NewConfigLineFromJson(`{"key":"id","condition":"not_format","value":"uuid"}`)
+	if err != nil {
+		t.Fatalf("NewConfigLine err:%s", err)
+	}
+	err = cnf.SetFormatCondition(cnfl)
+	if err != nil {
+		t.Fatalf("SetFormatCondition err:%s", err)
+	}
+	if cnf.TypeConditions[1].Condition.ccase != CaseNotFormat {
+		t.Errorf("case mismatch:\n given :%d\n expect :%d", cnf.TypeConditions[1].Condition.ccase, CaseNotFormat)
+	}
+
+	cnfl, err = NewConfigLineFromJson(`{"key":"id","condition":"contains","value":"uuid"}`)
+	if err != nil {
+		t.Fatalf("NewConfigLine err:%s", err)
+	}
+	err = cnf.SetFormatCondition(cnfl)
+	if err == nil {
+		t.Errorf("contains should be error")
+	}
+}
@@ -0,0 +1,459 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/types"
+	"strconv"
+	"time"
+)
+
+// Json forms of compiled rules. Values are written like rules of configuration.
+//  A string value which starts with a pseudo-field name is escaped like "$$TAG".
+
+// typeNames is the type name of Condition in Json.
+var typeNames = map[types.BasicKind]string{
+	types.Bool:    "bool",
+	types.String:  "str",
+	types.Int:     "int",
+	types.Uint:    "uint",
+	types.Float64: "double",
+}
+
+// escapePseudo converts "$TAG" to "$$TAG" to write it literally. It is the reverse of unescapePseudo.
+func escapePseudo(s string) string {
+	if looksPseudo(s) {
+		return "$" + s
+	}
+	return s
+}
+
+// escapedKeys returns keys of k which are written in configuration.
+func (k Keys) escapedKeys() []string {
+	ret := make([]string, len(k.Keys))
+	copy(ret, k.Keys)
+	if len(ret) > 0 && !k.pseudo {
+		ret[0] = escapePseudo(ret[0])
+	}
+	return ret
+}
+
+// decodeJsonNumber decodes b to v. Numbers are decoded as json.Number to keep precision.
+func decodeJsonNumber(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// MarshalJSON implements json.Marshaler. e.g. ["http","status"]
+func (k Keys) MarshalJSON() ([]byte, error) {
+	return json.Marshal(k.escapedKeys())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (k *Keys) UnmarshalJSON(b []byte) error {
+	var ss []string
+	if err := json.Unmarshal(b, &ss); err != nil {
+		return err
+	}
+	if len(ss) == 0 {
+		*k = Keys{}
+		return nil
+	}
+	ret, err := convertKeys(toInterfaces(ss))
+	if err != nil {
+		return err
+	}
+	*k = *ret
+	return nil
+}
+
+// existJson is the Json form of a rule of Exists and NotExists.
+type existJson struct {
+	Keys     Keys      `json:"keys"`
+	Metadata *Metadata `json:"metadata,omitempty"`
+}
+
+// rawConfig is Config without MarshalJSON and UnmarshalJSON.
+type rawConfig Config
+
+// configJson is the Json form of Config. Rules of Exists and NotExists are written with their metadata.
+type configJson struct {
+	rawConfig
+	Exists    []existJson `json:"exists,omitempty"`
+	NotExists []existJson `json:"not_exists,omitempty"`
+}
+
+// existJsons returns rules of keys with the metadata of rules.
+func existJsons(keys []Keys, rules []existRule) []existJson {
+	if len(keys) == 0 {
+		return nil
+	}
+	ret := make([]existJson, len(keys))
+	for i, k := range keys {
+		ret[i] = existJson{Keys: k, Metadata: existRuleOf(rules, i).metadata}
+	}
+	return ret
+}
+
+// fromExistJsons returns keys and their metadata of Json rules.
+func fromExistJsons(v []existJson) ([]Keys, []existRule, error) {
+	if len(v) == 0 {
+		return nil, nil, nil
+	}
+	keys := make([]Keys, len(v))
+	rules := make([]existRule, len(v))
+	for i, e := range v {
+		if len(e.Keys.Keys) == 0 {
+			return nil, nil, errors.New("blank key")
+		}
+		keys[i] = e.Keys
+		rules[i] = existRule{metadata: e.Metadata}
+	}
+	return keys, rules, nil
+}
+
+// MarshalJSON implements json.Marshaler.
+//  Rules of Exists and NotExists are written like {"keys":["a"],"metadata":{"id":"a-exists"}}.
+func (cnf Config) MarshalJSON() ([]byte, error) {
+	v := configJson{rawConfig: rawConfig(cnf)}
+	v.Exists = existJsons(cnf.Exists, cnf.existRules)
+	v.NotExists = existJsons(cnf.NotExists, cnf.notExistRules)
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (cnf *Config) UnmarshalJSON(b []byte) error {
+	v := configJson{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	ret := Config(v.rawConfig)
+	var err error
+	ret.Exists, ret.existRules, err = fromExistJsons(v.Exists)
+	if err != nil {
+		return err
+	}
+	ret.NotExists, ret.notExistRules, err = fromExistJsons(v.NotExists)
+	if err != nil {
+		return err
+	}
+	*cnf = ret
+	return nil
+}
+
+type conditionJson struct {
+	Type      string      `json:"type"`
+	Condition string      `json:"condition"`
+	Value     interface{} `json:"value"`
+}
+
+// MarshalJSON implements json.Marshaler. e.g. {"type":"int","condition":">=","value":200}
+func (c Condition) MarshalJSON() ([]byte, error) {
+	ret := conditionJson{Type: typeNames[c.ctype], Condition: IntCase2Str(c.ccase), Value: c.cvalue}
+	if ret.Type == "" {
+		return nil, fmt.Errorf("unknown type:%d", c.ctype)
+	}
+	if c.cref != "" {
+		ret.Value = c.cref
+	} else if s, ok := c.cvalue.(string); ok && c.ccase != CaseFormat && c.ccase != CaseNotFormat {
+		ret.Value = escapePseudo(s)
+	}
+	return json.Marshal(ret)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *Condition) UnmarshalJSON(b []byte) error {
+	v := conditionJson{}
+	if err := decodeJsonNumber(b, &v); err != nil {
+		return err
+	}
+	var t types.BasicKind
+	for k, name := range typeNames {
+		if name == v.Type {
+			t = k
+		}
+	}
+	if t == types.Invalid {
+		return fmt.Errorf("unknown type:%q", v.Type)
+	}
+	ccase := Str2IntCase(v.Condition)
+	if s, ok := v.Value.(string); ok && looksPseudo(s) {
+		ret, err := NewRefCondition(t, ccase, s)
+		if err != nil {
+			return err
+		}
+		*c = *ret
+		return nil
+	}
+
+	var ret *Condition
+	var err error
+	n, isNumber := v.Value.(json.Number)
+	switch {
+	case t == types.Bool:
+		bv, ok := v.Value.(bool)
+		if !ok {
+			return fmt.Errorf("json bool convert error type=%T", v.Value)
+		}
+		ret, err = NewBoolCondition(ccase, bv)
+	case t == types.String:
+		s, ok := v.Value.(string)
+		if !ok {
+			return fmt.Errorf("json string convert error type=%T", v.Value)
+		}
+		if ccase == CaseFormat || ccase == CaseNotFormat {
+			ret, err = NewFormatCondition(ccase, s)
+		} else {
+			ret, err = NewStringCondition(ccase, unescapePseudo(s))
+		}
+	case t == types.Int && isNumber:
+		i, perr := strconv.ParseInt(n.String(), 10, 0)
+		if perr != nil {
+			return perr
+		}
+		ret, err = NewIntCondition(ccase, int(i))
+	case t == types.Uint && isNumber:
+		u, perr := strconv.ParseUint(n.String(), 10, 0)
+		if perr != nil {
+			return perr
+		}
+		ret, err = NewUintCondition(ccase, uint(u))
+	case t == types.Float64 && isNumber:
+		f, perr := n.Float64()
+		if perr != nil {
+			return perr
+		}
+		ret, err = NewDoubleCondition(ccase, f)
+	default:
+		return fmt.Errorf("json number convert error type=%T", v.Value)
+	}
+	if err != nil {
+		return err
+	}
+	*c = *ret
+	return nil
+}
+
+// matcherJson is the Json form of the rule of a registered Matcher.
+type matcherJson struct {
+	Family    string      `json:"family"`
+	Condition string      `json:"condition,omitempty"`
+	Value     interface{} `json:"value,omitempty"`
+}
+
+type typeConditionJson struct {
+	Keys      Keys         `json:"keys"`
+	Condition *Condition   `json:"condition,omitempty"`
+	Matcher   *matcherJson `json:"matcher,omitempty"`
+	Metadata  *Metadata    `json:"metadata,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+//  A registered Matcher is written with its rule family name and the rule. It is created again by UnmarshalJSON.
+func (tc TypeCondition) MarshalJSON() ([]byte, error) {
+	ret := typeConditionJson{Keys: tc.Keys, Metadata: tc.Metadata}
+	if tc.Matcher != nil {
+		if tc.family == "" {
+			return nil, errors.New("Matcher has no rule family")
+		}
+		ret.Matcher = &matcherJson{Family: tc.family, Condition: tc.source.ClCondition, Value: tc.source.ClValue}
+	} else {
+		ret.Condition = &tc.Condition
+	}
+	return json.Marshal(ret)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (tc *TypeCondition) UnmarshalJSON(b []byte) error {
+	v := typeConditionJson{}
+	if err := decodeJsonNumber(b, &v); err != nil {
+		return err
+	}
+	ret := TypeCondition{Keys: v.Keys, Metadata: v.Metadata}
+	switch {
+	case v.Matcher != nil:
+		f, ok := lookupMatcher("key_" + v.Matcher.Family)
+		if !ok {
+			return fmt.Errorf("unknown rule family:%s", v.Matcher.Family)
+		}
+		line := ConfigLine{ClType: v.Matcher.Family, ClKey: toInterfaces(v.Keys.escapedKeys()), ClCondition: v.Matcher.Condition, ClValue: v.Matcher.Value}
+		m, err := f(&line)
+		if err != nil {
+			return err
+		}
+		ret.Matcher, ret.family, ret.source = m, v.Matcher.Family, line
+	case v.Condition != nil:
+		ret.Condition = *v.Condition
+	default:
+		return errors.New("no condition")
+	}
+	ret.TypeConditionStr = ret.String()
+	*tc = ret
+	return nil
+}
+
+type timeConditionJson struct {
+	Condition string      `json:"condition"`
+	Value     interface{} `json:"value"`
+	Layout    string      `json:"layout,omitempty"`
+	Timezone  string      `json:"timezone,omitempty"`
+}
+
+// value returns the value of c like "now-10m0s".
+func (c TimeCondition) value() interface{} {
+	switch {
+	case c.ref != "":
+		return c.ref
+	case c.relative && c.offset == 0:
+		return "now"
+	case c.relative && c.offset > 0:
+		return "now+" + c.offset.String()
+	case c.relative:
+		return "now" + c.offset.String()
+	}
+	return c.abs.Format(time.RFC3339Nano)
+}
+
+// timezone returns the name of the location of c. It is blank if it is UTC.
+func (c TimeCondition) timezone() string {
+	if c.loc == nil || c.loc == time.UTC {
+		return ""
+	}
+	return c.loc.String()
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c TimeCondition) MarshalJSON() ([]byte, error) {
+	return json.Marshal(timeConditionJson{Condition: IntCase2Str(c.ccase), Value: c.value(), Layout: c.layout, Timezone: c.timezone()})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *TimeCondition) UnmarshalJSON(b []byte) error {
+	v := timeConditionJson{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	ret, err := NewTimeCondition(Str2IntCase(v.Condition), v.Value, v.Layout, v.Timezone)
+	if err != nil {
+		return err
+	}
+	*c = *ret
+	return nil
+}
+
+type keyTimeConditionJson struct {
+	Keys      Keys          `json:"keys"`
+	Condition TimeCondition `json:"condition"`
+	Metadata  *Metadata     `json:"metadata,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (tc KeyTimeCondition) MarshalJSON() ([]byte, error) {
+	return json.Marshal(keyTimeConditionJson{Keys: tc.Keys, Condition: tc.Condition, Metadata: tc.Metadata})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (tc *KeyTimeCondition) UnmarshalJSON(b []byte) error {
+	v := keyTimeConditionJson{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*tc = KeyTimeCondition{Keys: v.Keys, Condition: v.Condition, Metadata: v.Metadata}
+	tc.TimeConditionStr = tc.String()
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. It is written like the rule of event_time.
+func (c EventTimeCondition) MarshalJSON() ([]byte, error) {
+	line := ConfigLine{ClCondition: IntCase2Str(c.ccase)}
+	switch {
+	case c.ccase == CaseNear:
+		line.ClKey = toInterfaces(c.Keys.escapedKeys())
+		line.ClValue = c.tolerance.String()
+		line.ClLayout = c.layout
+		line.ClTimezone = TimeCondition{loc: c.loc}.timezone()
+	case c.cond != nil:
+		line.ClValue = c.cond.value()
+		line.ClLayout = c.cond.layout
+		line.ClTimezone = c.cond.timezone()
+	}
+	line.setMetadata(c.Metadata)
+	return json.Marshal(line)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *EventTimeCondition) UnmarshalJSON(b []byte) error {
+	line := ConfigLine{}
+	if err := json.Unmarshal(b, &line); err != nil {
+		return err
+	}
+	ret, err := NewEventTimeCondition(&line)
+	if err != nil {
+		return err
+	}
+	ret.Metadata = line.metadata()
+	*c = *ret
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (p TagPattern) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.pattern)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (p *TagPattern) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	ret, err := NewTagPattern(s)
+	if err != nil {
+		return err
+	}
+	*p = *ret
+	return nil
+}
+
+type ruleSetJson struct {
+	Name     string      `json:"name,omitempty"`
+	Tag      *TagPattern `json:"tag,omitempty"`
+	When     *Config     `json:"when,omitempty"`
+	Config   Config      `json:"config"`
+	Metadata *Metadata   `json:"metadata,omitempty"`
+	Defined  bool        `json:"defined,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (rs RuleSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ruleSetJson{Name: rs.Name, Tag: rs.Tag, When: rs.When, Config: rs.Config, Metadata: rs.Metadata, Defined: rs.defined})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (rs *RuleSet) UnmarshalJSON(b []byte) error {
+	v := ruleSetJson{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*rs = RuleSet{Name: v.Name, Tag: v.Tag, When: v.When, Config: v.Config, Metadata: v.Metadata, defined: v.Defined}
+	return nil
+}
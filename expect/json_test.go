@@ -0,0 +1,202 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfigJsonRoundTrip(t *testing.T) {
+	d, err := NewRuleDocumentFromJson([]byte(`{
+  "aliases": {"req": ["http", "request"]},
+  "rules": [
+    {"type":"exists", "key":"log", "id":"log-exists", "labels":{"team":"web"}},
+    {"type":"not_exists", "key":"$$TAG"},
+    {"type":"bool", "key":"ok", "condition":"==", "value":true},
+    {"type":"str", "key":"$TAG", "condition":"regex", "value":"^app\\."},
+    {"type":"str", "key":"host", "condition":"==", "value":"$$TAG[0]"},
+    {"type":"str", "key":"service", "condition":"==", "value":"$TAG[1]"},
+    {"type":"int", "key":["@req","status"], "condition":"<", "value":500, "severity":"warn"},
+    {"type":"uint", "key":"size", "condition":"<=", "value":1024},
+    {"type":"double", "key":"ratio", "condition":">", "value":0.5},
+    {"type":"format", "key":"id", "condition":"format", "value":"uuid"},
+    {"type":"test_checksum", "key":"tenant", "condition":"valid", "id":"tenant-checksum"},
+    {"type":"time", "key":"time", "condition":">", "value":"now-10m", "layout":"2006-01-02 15:04:05", "timezone":"Asia/Tokyo"},
+    {"type":"time", "key":"start", "condition":"<", "value":"2021-04-01T12:00:00+09:00"},
+    {"type":"time", "key":"end", "condition":">=", "value":"$TIME"},
+    {"type":"event_time", "condition":"near", "key":"time", "value":"1m", "layout":"2006-01-02 15:04:05", "timezone":"Asia/Tokyo"},
+    {"type":"event_time", "condition":"<", "value":"now+1h", "id":"not-future"},
+    {"type":"ruleset", "name":"login", "owner":"team-auth",
+     "when":[{"type":"str", "key":"event", "condition":"==", "value":"login"}]},
+    {"type":"exists", "key":"user", "ruleset":"login"},
+    {"type":"int", "key":"code", "condition":"!=", "value":0, "tag":"batch.*"}
+  ]
+}`))
+	if err != nil {
+		t.Fatalf("NewRuleDocumentFromJson err:%s", err)
+	}
+	cnf := &Config{}
+	if err := cnf.ApplyRuleDocument(d); err != nil {
+		t.Fatalf("ApplyRuleDocument err:%s", err)
+	}
+
+	b, err := json.Marshal(cnf)
+	if err != nil {
+		t.Fatalf("Marshal err:%s", err)
+	}
+	ret := &Config{}
+	if err := json.Unmarshal(b, ret); err != nil {
+		t.Fatalf("Unmarshal err:%s\n%s", err, b)
+	}
+	b2, err := json.Marshal(ret)
+	if err != nil {
+		t.Fatalf("Marshal err:%s", err)
+	}
+	if string(b) != string(b2) {
+		t.Errorf("mismatch:\n given :%s\n expect:%s", b2, b)
+	}
+	for i, v := range ret.TypeConditions {
+		if v.TypeConditionStr != cnf.TypeConditions[i].TypeConditionStr {
+			t.Errorf("%d mismatch:\n given :%s\n expect:%s", i, v.TypeConditionStr, cnf.TypeConditions[i].TypeConditionStr)
+		}
+	}
+	if m := ret.existRules[0].metadata; m == nil || m.ID != "log-exists" || m.Labels["team"] != "web" {
+		t.Errorf("metadata of exists mismatch:%+v", m)
+	}
+
+	now := time.Date(2021, 4, 1, 12, 0, 0, 0, time.UTC)
+	records := []map[interface{}]interface{}{
+		{
+			"log":     "hello",
+			"ok":      true,
+			"host":    "$TAG[0]",
+			"service": "web",
+			"http":    map[interface{}]interface{}{"request": map[interface{}]interface{}{"status": int64(200)}},
+			"size":    uint64(10),
+			"ratio":   0.9,
+			"id":      "0b8a6a26-2f5c-4a64-9d39-8c1e2b1f0a3e",
+			"tenant":  "1236",
+			"time":    "2021-04-01 20:59:30",
+			"start":   "2021-04-01T11:00:00+09:00",
+			"end":     "2021-04-01T12:00:00Z",
+		},
+		{
+			"ok":     false,
+			"host":   "app",
+			"tenant": "1234",
+			"time":   "2021-04-01 10:00:00",
+			"event":  "login",
+			"code":   int64(1),
+		},
+	}
+	for i, r := range records {
+		for _, tag := range []string{"app.web", "batch.daily"} {
+			given := evaluateStrings(ret, tag, now, r)
+			expect := evaluateStrings(cnf, tag, now, r)
+			if !reflect.DeepEqual(given, expect) {
+				t.Errorf("%d %s mismatch:\n given :%v\n expect:%v", i, tag, given, expect)
+			}
+		}
+	}
+}
+
+func evaluateStrings(cnf *Config, tag string, now time.Time, record map[interface{}]interface{}) []string {
+	ev := NewEvaluator(cnf)
+	ev.Now = func() time.Time { return now }
+	ret := []string{}
+	for _, f := range ev.Evaluate(tag, now, record) {
+		ret = append(ret, f.Error())
+	}
+	return ret
+}
+
+func TestConditionJson(t *testing.T) {
+	type testcase struct {
+		name  string
+		value string
+	}
+
+	cases := []testcase{
+		{"int", `{"type":"int","condition":"==","value":-10}`},
+		{"large int", `{"type":"int","condition":"!=","value":9007199254740993}`},
+		{"uint", `{"type":"uint","condition":">","value":18446744073709551615}`},
+		{"double", `{"type":"double","condition":"<","value":1.5}`},
+		{"bool", `{"type":"bool","condition":"!=","value":false}`},
+		{"str", `{"type":"str","condition":"contains","value":"abc"}`},
+		{"escaped", `{"type":"str","condition":"==","value":"$$TAG"}`},
+		{"escaped twice", `{"type":"str","condition":"==","value":"$$$TIME"}`},
+		{"ref", `{"type":"int","condition":"==","value":"$TAG[2]"}`},
+		{"format", `{"type":"str","condition":"not_format","value":"ipv4"}`},
+	}
+
+	for _, v := range cases {
+		c := Condition{}
+		if err := json.Unmarshal([]byte(v.value), &c); err != nil {
+			t.Errorf("%s: Unmarshal err:%s", v.name, err)
+			continue
+		}
+		b, err := json.Marshal(c)
+		if err != nil {
+			t.Errorf("%s: Marshal err:%s", v.name, err)
+			continue
+		}
+		if !jsonEqual(b, []byte(v.value)) {
+			t.Errorf("%s mismatch:\n given :%s\n expect:%s", v.name, b, v.value)
+		}
+	}
+}
+
+// jsonEqual check if a and b are same Json. Numbers are compared as strings.
+func jsonEqual(a, b []byte) bool {
+	var av, bv interface{}
+	if err := decodeJsonNumber(a, &av); err != nil {
+		return false
+	}
+	if err := decodeJsonNumber(b, &bv); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+func TestConditionJsonError(t *testing.T) {
+	cases := []string{
+		`{"type":"float","condition":"==","value":1}`,
+		`{"type":"int","condition":"==","value":1.5}`,
+		`{"type":"uint","condition":"==","value":-1}`,
+		`{"type":"int","condition":"==","value":"1"}`,
+		`{"type":"bool","condition":">","value":true}`,
+		`{"type":"str","condition":"==","value":"$TAG[x]"}`,
+	}
+
+	for _, v := range cases {
+		c := Condition{}
+		if err := json.Unmarshal([]byte(v), &c); err == nil {
+			t.Errorf("%s: expect error", v)
+		}
+	}
+}
+
+func TestTypeConditionJsonUnknownFamily(t *testing.T) {
+	tc := TypeCondition{}
+	err := json.Unmarshal([]byte(`{"keys":["a"],"matcher":{"family":"unknown","condition":"valid"}}`), &tc)
+	if err == nil {
+		t.Errorf("expect error")
+	}
+}
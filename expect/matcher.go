@@ -0,0 +1,148 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Matcher checks a value of a record.
+//  Condition implements Matcher. Other Matchers can be registered by RegisterMatcher.
+type Matcher interface {
+	// Match check if v matches. An error should wrap ErrTypeMismatch or ErrParse to classify Failure.
+	Match(v interface{}) (bool, error)
+	// String returns the condition like "== 10". It is used by reports.
+	String() string
+	// Equal check if m is the same condition. Equal Matchers of the same key are duplicated rules.
+	Equal(m Matcher) bool
+}
+
+// MatcherFactory returns Matcher via the rule c.
+//  "condition" and "value" of c are as they are written. The value of Json is string, json.Number, bool, array or object.
+//  The value of the expect parameter is string.
+type MatcherFactory func(c *ConfigLine) (Matcher, error)
+
+// matchers is the registry of MatcherFactory. The key is the rule family name.
+var matchers = struct {
+	sync.RWMutex
+	m map[string]MatcherFactory
+}{m: map[string]MatcherFactory{}}
+
+// RegisterMatcher registers f as the rule family name like "tenant_checksum".
+//  The rule can be written as "key_tenant_checksumN", "type":"tenant_checksum" and "$key tenant_checksum condition value".
+//  It should be called in init() of the package which is built into the plugin.
+func RegisterMatcher(name string, f MatcherFactory) error {
+	if name == "" || f == nil {
+		return errors.New("RegisterMatcher:blank name or nil factory")
+	}
+	if _, ok := builtinRuleName(name); ok {
+		return fmt.Errorf("RegisterMatcher:%s already defined", name)
+	}
+	matchers.Lock()
+	defer matchers.Unlock()
+	if _, ok := matchers.m[name]; ok {
+		return fmt.Errorf("RegisterMatcher:%s already defined", name)
+	}
+	matchers.m[name] = f
+	return nil
+}
+
+// RuleNames returns ConfigRuleNames and the rule names of the registered families like "key_tenant_checksum".
+func RuleNames() []string {
+	matchers.RLock()
+	defer matchers.RUnlock()
+	families := make([]string, 0, len(matchers.m))
+	for name := range matchers.m {
+		families = append(families, "key_"+name)
+	}
+	sort.Strings(families)
+	return append(append([]string{}, ConfigRuleNames...), families...)
+}
+
+// lookupMatcher returns MatcherFactory of the rule name like "key_tenant_checksum".
+func lookupMatcher(name string) (MatcherFactory, bool) {
+	matchers.RLock()
+	defer matchers.RUnlock()
+	if len(name) <= len("key_") || name[:len("key_")] != "key_" {
+		return nil, false
+	}
+	f, ok := matchers.m[name[len("key_"):]]
+	return f, ok
+}
+
+// isMatcherFamily check if typ is a registered rule family name.
+func isMatcherFamily(typ string) bool {
+	_, ok := lookupMatcher("key_" + typ)
+	return ok
+}
+
+// Match implements Matcher. It is same as IsMatch.
+func (c Condition) Match(v interface{}) (bool, error) {
+	return c.IsMatch(v)
+}
+
+// Equal implements Matcher. It is same as Compare.
+func (c Condition) Equal(m Matcher) bool {
+	ic, ok := m.(Condition)
+	return ok && c.Compare(ic)
+}
+
+// matcher returns Matcher of tc.
+func (tc TypeCondition) matcher() Matcher {
+	if tc.Matcher != nil {
+		return tc.Matcher
+	}
+	return tc.Condition
+}
+
+// match check if v matches tc. A pseudo-field of Condition is resolved via r.
+func (tc TypeCondition) match(r *Record, v interface{}) (bool, error) {
+	if tc.Matcher != nil {
+		return tc.Matcher.Match(v)
+	}
+	cnd, err := tc.Condition.Resolve(r)
+	if err != nil {
+		return false, err
+	}
+	return cnd.IsMatch(v)
+}
+
+// SetMatcher sets the rule whose Matcher is created by f via c.
+//  ClType of c should be the rule family name to marshal the rule to Json.
+func (cnf *Config) SetMatcher(c *ConfigLine, f MatcherFactory) error {
+	if c == nil {
+		return errors.New("ConfigLine is nil")
+	}
+	k, err := convertKeys(c.ClKey)
+	if err != nil {
+		return fmt.Errorf("SetMatcher:%w", err)
+	}
+	m, err := f(c)
+	if err != nil {
+		return fmt.Errorf("SetMatcher:%w", err)
+	}
+	if m == nil {
+		return errors.New("SetMatcher:Matcher is nil")
+	}
+	tc := &TypeCondition{Keys: *k, Matcher: m, Metadata: c.metadata(), family: c.ClType, source: *c, param: c.ClParam}
+	tc.TypeConditionStr = tc.String()
+	cnf.TypeConditions = append(cnf.TypeConditions, *tc)
+	return nil
+}
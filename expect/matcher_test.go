@@ -0,0 +1,220 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// checksumMatcher checks if the last digit of a string is the sum of other digits mod 10.
+type checksumMatcher struct {
+	valid bool
+}
+
+func (m checksumMatcher) Match(v interface{}) (bool, error) {
+	s, ok := v.(string)
+	if !ok {
+		return false, fmt.Errorf("%w: %T", ErrTypeMismatch, v)
+	}
+	if s == "" {
+		return false, fmt.Errorf("%w: blank", ErrParse)
+	}
+	sum := 0
+	for _, r := range s[:len(s)-1] {
+		sum += int(r - '0')
+	}
+	return (sum%10 == int(s[len(s)-1]-'0')) == m.valid, nil
+}
+
+func (m checksumMatcher) String() string {
+	if m.valid {
+		return "checksum valid"
+	}
+	return "checksum invalid"
+}
+
+func (m checksumMatcher) Equal(im Matcher) bool {
+	c, ok := im.(checksumMatcher)
+	return ok && c.valid == m.valid
+}
+
+func init() {
+	err := RegisterMatcher("test_checksum", func(c *ConfigLine) (Matcher, error) {
+		switch c.ClCondition {
+		case "valid":
+			return checksumMatcher{valid: true}, nil
+		case "invalid":
+			return checksumMatcher{valid: false}, nil
+		}
+		return nil, errors.New("unknown condition:" + c.ClCondition)
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisterMatcher(t *testing.T) {
+	f := func(c *ConfigLine) (Matcher, error) { return checksumMatcher{}, nil }
+
+	type testcase struct {
+		name string
+		f    MatcherFactory
+	}
+
+	cases := []testcase{
+		{"", f},
+		{"test_nil", nil},
+		{"int", f},
+		{"exists", f},
+		{"test_checksum", f},
+	}
+
+	for _, v := range cases {
+		if err := RegisterMatcher(v.name, v.f); err == nil {
+			t.Errorf("%q: expect error", v.name)
+		}
+	}
+}
+
+func TestRuleNames(t *testing.T) {
+	for _, name := range ConfigRuleNames {
+		if name == "key_test_checksum" {
+			t.Errorf("registered family should not be in ConfigRuleNames")
+		}
+	}
+	names := RuleNames()
+	found := false
+	for _, name := range names[len(ConfigRuleNames):] {
+		found = found || name == "key_test_checksum"
+	}
+	if !found {
+		t.Errorf("key_test_checksum is not found:%v", names)
+	}
+	for _, typ := range []string{"test_checksum", "key_test_checksum"} {
+		if name, err := RuleNameOfType(typ); err != nil || name != "key_test_checksum" {
+			t.Errorf("%s: mismatch given=%s err=%v", typ, name, err)
+		}
+	}
+}
+
+func TestRegisterMatcherConcurrent(t *testing.T) {
+	f := func(c *ConfigLine) (Matcher, error) { return checksumMatcher{}, nil }
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			if err := RegisterMatcher(fmt.Sprintf("test_concurrent%d", i), f); err != nil {
+				t.Errorf("RegisterMatcher err:%s", err)
+			}
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		RuleNameOfType(fmt.Sprintf("test_concurrent%d", i))
+		RuleNames()
+	}
+	<-done
+	if _, err := RuleNameOfType("test_concurrent9"); err != nil {
+		t.Errorf("RuleNameOfType err:%s", err)
+	}
+}
+
+func TestSetMatcher(t *testing.T) {
+	d, err := NewRuleDocumentFromJson([]byte(`[
+  {"type":"test_checksum", "key":"tenant", "condition":"valid", "id":"tenant-checksum"},
+  {"type":"test_checksum", "key":"tenant", "condition":"valid"}
+]`))
+	if err != nil {
+		t.Fatalf("NewRuleDocumentFromJson err:%s", err)
+	}
+	cnf := &Config{}
+	if err := cnf.ApplyRuleDocument(d); err != nil {
+		t.Fatalf("ApplyRuleDocument err:%s", err)
+	}
+	lines, err := ParseRules(`$tenant test_checksum valid tag app.*`)
+	if err != nil {
+		t.Fatalf("ParseRules err:%s", err)
+	}
+	if err := cnf.ApplyRuleDocument(&RuleDocument{Rules: lines}); err != nil {
+		t.Fatalf("ApplyRuleDocument err:%s", err)
+	}
+	c, err := NewConfigLineFromJson(`{"key":"tenant", "condition":"unknown"}`)
+	if err != nil {
+		t.Fatalf("NewConfigLineFromJson err:%s", err)
+	}
+	if err := cnf.SetConfigLine("key_test_checksum", c); err == nil {
+		t.Errorf("unknown condition should be error")
+	}
+
+	if len(cnf.TypeConditions) != 2 || cnf.TypeConditions[0].TypeConditionStr != `"tenant" checksum valid` {
+		t.Fatalf("mismatch:%+v", cnf.TypeConditions)
+	}
+	if len(cnf.RuleSets) != 1 || len(cnf.RuleSets[0].TypeConditions) != 1 {
+		t.Errorf("tag mismatch:%+v", cnf.RuleSets)
+	}
+	if !cnf.HasTypeCondition(&cnf.TypeConditions[1]) {
+		t.Errorf("HasTypeCondition should be true")
+	}
+	findings := cnf.Analyze()
+	if len(findings) != 1 || findings[0].Message != `"tenant" checksum valid is duplicated` {
+		t.Errorf("findings mismatch:%v", findings)
+	}
+
+	ev := NewEvaluator(cnf)
+	type testcase struct {
+		name   string
+		value  interface{}
+		expect []FailureKind
+	}
+	cases := []testcase{
+		{"valid", "1236", nil},
+		{"invalid", "1237", []FailureKind{FailureConditionFalse, FailureConditionFalse, FailureConditionFalse}},
+		{"type mismatch", int64(1236), []FailureKind{FailureTypeMismatch, FailureTypeMismatch, FailureTypeMismatch}},
+		{"parse error", "", []FailureKind{FailureParseError, FailureParseError, FailureParseError}},
+	}
+	for _, v := range cases {
+		ret := ev.Evaluate("app.web", time.Now(), map[interface{}]interface{}{"tenant": v.value})
+		if len(ret) != len(v.expect) {
+			t.Errorf("%s: length mismatch:%v", v.name, ret)
+			continue
+		}
+		for i, f := range ret {
+			if f.Kind != v.expect[i] {
+				t.Errorf("%s: %d mismatch given:%s expect:%s", v.name, i, f.Kind, v.expect[i])
+			}
+		}
+		if b := cnf.IsMatch(&Record{Tag: "app.web", Map: map[interface{}]interface{}{"tenant": v.value}}, time.Now()); b != (v.expect == nil) {
+			t.Errorf("%s: IsMatch mismatch:%t", v.name, b)
+		}
+	}
+}
+
+func TestConditionMatcher(t *testing.T) {
+	a, _ := NewIntCondition(CaseEq, 1)
+	b, _ := NewIntCondition(CaseEq, 1)
+	c, _ := NewIntCondition(CaseNe, 1)
+
+	var m Matcher = *a
+	if !m.Equal(*b) || m.Equal(*c) || m.Equal(checksumMatcher{}) {
+		t.Errorf("Equal mismatch")
+	}
+	if ok, err := m.Match(int64(1)); err != nil || !ok {
+		t.Errorf("Match mismatch:%t %v", ok, err)
+	}
+}
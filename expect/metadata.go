@@ -0,0 +1,142 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Metadata represents information of a rule which is reported with its failure.
+type Metadata struct {
+	ID          string            `json:"id,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Owner       string            `json:"owner,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	RunbookURL  string            `json:"runbook_url,omitempty"`
+	Severity    string            `json:"severity,omitempty"` // "info", "warn", "error" or "fatal". See Level.
+}
+
+// IsEmpty check if m has no information.
+func (m *Metadata) IsEmpty() bool {
+	return m == nil || (m.ID == "" && m.Description == "" && m.Owner == "" && len(m.Labels) == 0 && m.RunbookURL == "" && m.Severity == "")
+}
+
+// Merge returns m whose blank fields are filled by d.
+//  Labels of d are added if m doesn't have them. m and d are not modified.
+func (m *Metadata) Merge(d *Metadata) *Metadata {
+	if d.IsEmpty() {
+		return m
+	}
+	if m.IsEmpty() {
+		return d
+	}
+	ret := *m
+	if ret.ID == "" {
+		ret.ID = d.ID
+	}
+	if ret.Description == "" {
+		ret.Description = d.Description
+	}
+	if ret.Owner == "" {
+		ret.Owner = d.Owner
+	}
+	if ret.RunbookURL == "" {
+		ret.RunbookURL = d.RunbookURL
+	}
+	if ret.Severity == "" {
+		ret.Severity = d.Severity
+	}
+	if len(d.Labels) > 0 {
+		ret.Labels = map[string]string{}
+		for k, v := range d.Labels {
+			ret.Labels[k] = v
+		}
+		for k, v := range m.Labels {
+			ret.Labels[k] = v
+		}
+	}
+	return &ret
+}
+
+// String implements fmt.Stringer. e.g.
+//    id=http-status severity=warn owner=team-web labels={env=prod} runbook_url=https://example.com description="status is valid"
+//  It returns blank if m is empty.
+func (m *Metadata) String() string {
+	if m.IsEmpty() {
+		return ""
+	}
+	ss := []string{}
+	if m.ID != "" {
+		ss = append(ss, "id="+m.ID)
+	}
+	if m.Severity != "" {
+		ss = append(ss, "severity="+m.Severity)
+	}
+	if m.Owner != "" {
+		ss = append(ss, "owner="+m.Owner)
+	}
+	if len(m.Labels) > 0 {
+		keys := make([]string, 0, len(m.Labels))
+		for k := range m.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for i, k := range keys {
+			keys[i] = k + "=" + m.Labels[k]
+		}
+		ss = append(ss, "labels={"+strings.Join(keys, ",")+"}")
+	}
+	if m.RunbookURL != "" {
+		ss = append(ss, "runbook_url="+m.RunbookURL)
+	}
+	if m.Description != "" {
+		ss = append(ss, "description="+strconv.Quote(m.Description))
+	}
+	return strings.Join(ss, " ")
+}
+
+// Level returns the severity of the rule. The default is SeverityError.
+func (m *Metadata) Level() Severity {
+	if m == nil || m.Severity == "" {
+		return SeverityError
+	}
+	s, err := ParseSeverity(m.Severity)
+	if err != nil {
+		return SeverityError
+	}
+	return s
+}
+
+// metadata returns the Metadata of c. It returns nil if c has no metadata.
+func (c *ConfigLine) metadata() *Metadata {
+	m := &Metadata{ID: c.ClID, Description: c.ClDescription, Owner: c.ClOwner, Labels: c.ClLabels, RunbookURL: c.ClRunbookURL, Severity: c.ClSeverity}
+	if m.IsEmpty() {
+		return nil
+	}
+	return m
+}
+
+// setMetadata sets m to blank metadata fields of c.
+func (c *ConfigLine) setMetadata(m *Metadata) {
+	if m = c.metadata().Merge(m); m == nil {
+		return
+	}
+	c.ClID, c.ClDescription, c.ClOwner, c.ClLabels, c.ClRunbookURL = m.ID, m.Description, m.Owner, m.Labels, m.RunbookURL
+	c.ClSeverity = m.Severity
+}
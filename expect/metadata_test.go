@@ -0,0 +1,134 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMetadataString(t *testing.T) {
+	type testcase struct {
+		name   string
+		meta   *Metadata
+		expect string
+	}
+
+	cases := []testcase{
+		{"nil", nil, ""},
+		{"empty", &Metadata{}, ""},
+		{"id", &Metadata{ID: "http-status"}, "id=http-status"},
+		{"severity", &Metadata{ID: "http-status", Severity: "warn"}, "id=http-status severity=warn"},
+		{"all", &Metadata{ID: "http-status", Description: "status is valid", Owner: "team-web",
+			Labels: map[string]string{"tier": "web", "env": "prod"}, RunbookURL: "https://example.com/runbook"},
+			`id=http-status owner=team-web labels={env=prod,tier=web} runbook_url=https://example.com/runbook description="status is valid"`},
+	}
+
+	for _, v := range cases {
+		ret := v.meta.String()
+		if ret != v.expect {
+			t.Errorf("%s: mismatch\n given :%s\n expect:%s", v.name, ret, v.expect)
+		}
+	}
+}
+
+func TestMetadataMerge(t *testing.T) {
+	type testcase struct {
+		name     string
+		meta     *Metadata
+		defaults *Metadata
+		expect   *Metadata
+	}
+
+	cases := []testcase{
+		{"nil", nil, nil, nil},
+		{"no defaults", &Metadata{ID: "a"}, nil, &Metadata{ID: "a"}},
+		{"defaults only", nil, &Metadata{Owner: "team"}, &Metadata{Owner: "team"}},
+		{"fill blank", &Metadata{ID: "a", Labels: map[string]string{"env": "dev"}},
+			&Metadata{ID: "b", Owner: "team", Labels: map[string]string{"env": "prod", "tier": "web"}},
+			&Metadata{ID: "a", Owner: "team", Labels: map[string]string{"env": "dev", "tier": "web"}}},
+	}
+
+	for _, v := range cases {
+		ret := v.meta.Merge(v.defaults)
+		if !reflect.DeepEqual(ret, v.expect) {
+			t.Errorf("%s: mismatch\n given :%+v\n expect:%+v", v.name, ret, v.expect)
+		}
+	}
+}
+
+func TestSetConfigLineMetadata(t *testing.T) {
+	d, err := NewRuleDocumentFromJson([]byte(`{
+  "templates": {
+    "status": [
+      {"type":"int", "key":"status", "condition":"<", "value":500, "id":"status-5xx"}
+    ]
+  },
+  "rules": [
+    {"type":"exists", "key":"log", "id":"log-exists", "owner":"team-log"},
+    {"type":"str", "key":"level", "condition":"!=", "value":"fatal", "labels":{"env":"prod"}},
+    {"type":"use", "template":"status", "at":"http", "owner":"team-web"},
+    {"type":"ruleset", "name":"login", "owner":"team-auth", "runbook_url":"https://example.com/login",
+     "when":[{"type":"str", "key":"event", "condition":"==", "value":"login"}]},
+    {"type":"event_time", "condition":"not_zero", "ruleset":"login", "id":"login-time"}
+  ]
+}`))
+	if err != nil {
+		t.Fatalf("NewRuleDocumentFromJson err:%s", err)
+	}
+	cnf := &Config{}
+	err = cnf.ApplyRuleDocument(d)
+	if err != nil {
+		t.Fatalf("ApplyRuleDocument err:%s", err)
+	}
+
+	if !reflect.DeepEqual(cnf.existRules[0].metadata, &Metadata{ID: "log-exists", Owner: "team-log"}) {
+		t.Errorf("exists mismatch:%+v", cnf.existRules[0].metadata)
+	}
+	if !reflect.DeepEqual(cnf.TypeConditions[0].Metadata, &Metadata{Labels: map[string]string{"env": "prod"}}) {
+		t.Errorf("str mismatch:%+v", cnf.TypeConditions[0].Metadata)
+	}
+	if !reflect.DeepEqual(cnf.TypeConditions[1].Metadata, &Metadata{ID: "status-5xx", Owner: "team-web"}) {
+		t.Errorf("use mismatch:%+v", cnf.TypeConditions[1].Metadata)
+	}
+	rs := cnf.RuleSets[0]
+	if !reflect.DeepEqual(rs.Metadata, &Metadata{Owner: "team-auth", RunbookURL: "https://example.com/login"}) {
+		t.Errorf("ruleset mismatch:%+v", rs.Metadata)
+	}
+	if !reflect.DeepEqual(rs.EventTimeConditions[0].Metadata, &Metadata{ID: "login-time"}) {
+		t.Errorf("event_time mismatch:%+v", rs.EventTimeConditions[0].Metadata)
+	}
+	if rs.When.TypeConditions[0].Metadata != nil {
+		t.Errorf("when should not have metadata:%+v", rs.When.TypeConditions[0].Metadata)
+	}
+}
+
+func TestParseRulesMetadata(t *testing.T) {
+	lines, err := ParseRules(`$status int < 500 id status-5xx severity fatal owner team-web label env=prod label "tier=web" description "no 5xx"`)
+	if err != nil {
+		t.Fatalf("ParseRules err:%s", err)
+	}
+	expect := Metadata{ID: "status-5xx", Severity: "fatal", Owner: "team-web", Description: "no 5xx", Labels: map[string]string{"env": "prod", "tier": "web"}}
+	if len(lines) != 1 || !reflect.DeepEqual(lines[0].metadata(), &expect) {
+		t.Errorf("mismatch:%+v", lines)
+	}
+
+	_, err = ParseRules(`$status int < 500 label env`)
+	if err == nil {
+		t.Errorf("label without value should be error")
+	}
+}
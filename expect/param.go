@@ -0,0 +1,110 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// DefaultMaxIndex is the maximum index of parameters which are looked up.
+const DefaultMaxIndex = 1023
+const ConfigMaxIndexKeyName = "max_index"
+
+// Param represents a parameter of configuration like "key_int0".
+type Param struct {
+	Name  string // rule name like "key_int"
+	Index int
+	Value string
+}
+
+// Key returns the configuration name like "key_int0".
+func (p Param) Key() string {
+	return p.Name + strconv.Itoa(p.Index)
+}
+
+// rangeString returns "n" or "n-m".
+func rangeString(n, m int) string {
+	if n == m {
+		return strconv.Itoa(n)
+	}
+	return strconv.Itoa(n) + "-" + strconv.Itoa(m)
+}
+
+// ParamWarning represents a warning of parameters.
+type ParamWarning struct {
+	Param     Param  // the warned parameter
+	Duplicate *Param // the parameter which has the same value. nil if indexes before Param are skipped.
+	skipped   int    // the first skipped index
+	capped    bool   // Param is at the maximum index and larger indexes are not looked up.
+}
+
+func (w ParamWarning) String() string {
+	if w.capped {
+		return fmt.Sprintf("%s reached %s=%d. larger indexes are ignored", w.Param.Name, ConfigMaxIndexKeyName, w.Param.Index)
+	}
+	if w.Duplicate != nil {
+		return fmt.Sprintf("%s is duplicated with %s", w.Param.Key(), w.Duplicate.Key())
+	}
+	return fmt.Sprintf("%s%s is skipped", w.Param.Name, rangeString(w.skipped, w.Param.Index-1))
+}
+
+// LookupParams looks up parameters of names with index from 0 to max.
+//  lookup returns the value of the configuration name or "" if it is not found.
+//  It returns found parameters ordered by index and warnings of skipped or duplicated indexes.
+//  It also warns if the name has the parameter of max since larger indexes may be ignored.
+func LookupParams(lookup func(string) string, names []string, max int) ([]Param, []ParamWarning) {
+	ret := []Param{}
+	warns := []ParamWarning{}
+	found := make(map[string][]Param)
+
+	for _, name := range names {
+		for i := 0; i <= max; i++ {
+			p := Param{Name: name, Index: i}
+			p.Value = lookup(p.Key())
+			if p.Value == "" {
+				continue
+			}
+			ret = append(ret, p)
+			found[name] = append(found[name], p)
+			if i == max {
+				warns = append(warns, ParamWarning{Param: p, capped: true})
+			}
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Index < ret[j].Index
+	})
+
+	for _, name := range names {
+		next := 0
+		values := make(map[string]Param)
+		for _, p := range found[name] {
+			if p.Index > next {
+				warns = append(warns, ParamWarning{Param: p, skipped: next})
+			}
+			next = p.Index + 1
+			if dup, ok := values[p.Value]; ok {
+				warns = append(warns, ParamWarning{Param: p, Duplicate: &dup})
+			} else {
+				values[p.Value] = p
+			}
+		}
+	}
+	return ret, warns
+}
@@ -0,0 +1,100 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLookupParams(t *testing.T) {
+	conf := map[string]string{
+		"key_exists0":   `{"key":"a"}`,
+		"key_exists1":   `{"key":"b"}`,
+		"key_exists2":   `{"key":"a"}`,
+		"key_int3":      `{"key":"c", "condition":"==", "value":1}`,
+		"key_int100":    `{"key":"d", "condition":"==", "value":1}`,
+		"key_int2000":   `{"key":"e", "condition":"==", "value":1}`,
+		"key_unknown0":  `{"key":"f"}`,
+		"key_not_exist": `{"key":"g"}`,
+	}
+	lookup := func(s string) string {
+		return conf[s]
+	}
+
+	params, warns := LookupParams(lookup, []string{ConfigExistKeyName, ConfigIntKeyName}, DefaultMaxIndex)
+	expect := []string{"key_exists0", "key_exists1", "key_exists2", "key_int3", "key_int100"}
+	if len(params) != len(expect) {
+		t.Fatalf("length mismatch:\n given :%+v\n expect:%v", params, expect)
+	}
+	for i, v := range params {
+		if v.Key() != expect[i] {
+			t.Errorf("%d mismatch:\n given :%s\n expect:%s", i, v.Key(), expect[i])
+		}
+		if v.Value != conf[expect[i]] {
+			t.Errorf("%d value mismatch:\n given :%s\n expect:%s", i, v.Value, conf[expect[i]])
+		}
+	}
+
+	expectWarns := []string{
+		"key_exists2 is duplicated with key_exists0",
+		"key_int0-2 is skipped",
+		"key_int4-99 is skipped",
+	}
+	if len(warns) != len(expectWarns) {
+		t.Fatalf("warns mismatch:\n given :%v\n expect:%v", warns, expectWarns)
+	}
+	for i, v := range warns {
+		if v.String() != expectWarns[i] {
+			t.Errorf("%d mismatch:\n given :%s\n expect:%s", i, v, expectWarns[i])
+		}
+		if (v.Duplicate != nil) != (i == 0) {
+			t.Errorf("%d Duplicate mismatch:%v", i, v.Duplicate)
+		}
+	}
+
+	type testcase struct {
+		name   string
+		max    int
+		expect []string
+		warns  []string
+	}
+	cases := []testcase{
+		{"large max", 2000, []string{"key_int3", "key_int100", "key_int2000"},
+			[]string{"key_int reached max_index=2000. larger indexes are ignored", "key_int0-2 is skipped", "key_int4-99 is skipped", "key_int101-1999 is skipped"}},
+		{"max", 100, []string{"key_int3", "key_int100"},
+			[]string{"key_int reached max_index=100. larger indexes are ignored", "key_int0-2 is skipped", "key_int4-99 is skipped"}},
+		{"small max", 50, []string{"key_int3"}, []string{"key_int0-2 is skipped"}},
+	}
+	for _, v := range cases {
+		params, warns := LookupParams(lookup, []string{ConfigIntKeyName}, v.max)
+		given := []string{}
+		for _, p := range params {
+			given = append(given, p.Key())
+		}
+		if !reflect.DeepEqual(given, v.expect) {
+			t.Errorf("%s mismatch:\n given :%v\n expect:%v", v.name, given, v.expect)
+		}
+		givenWarns := []string{}
+		for _, w := range warns {
+			givenWarns = append(givenWarns, w.String())
+		}
+		if !reflect.DeepEqual(givenWarns, v.warns) {
+			t.Errorf("%s warns mismatch:\n given :%v\n expect:%v", v.name, givenWarns, v.warns)
+		}
+	}
+}
\ No newline at end of file
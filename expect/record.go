@@ -0,0 +1,99 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Pseudo-fields which can be used as keys and values.
+//  "$TAG[n]" is the n-th element of the tag split on dots.
+const (
+	PseudoTag  = "$TAG"
+	PseudoTime = "$TIME" // epoch seconds of the event time as float64
+)
+
+// Record represents a record with its tag and timestamp.
+type Record struct {
+	Tag  string
+	Time EventTime
+	Map  map[interface{}]interface{}
+}
+
+// parsePseudo parses pseudo-field s.
+//  It returns the name of pseudo-field and the index of "$TAG[n]".
+//  The index is -1 if it is not specified.
+func parsePseudo(s string) (string, int, bool) {
+	switch s {
+	case PseudoTag, PseudoTime:
+		return s, -1, true
+	}
+	if !strings.HasPrefix(s, PseudoTag+"[") || !strings.HasSuffix(s, "]") {
+		return "", -1, false
+	}
+	n, err := strconv.Atoi(s[len(PseudoTag)+1 : len(s)-1])
+	if err != nil || n < 0 {
+		return "", -1, false
+	}
+	return PseudoTag, n, true
+}
+
+// isPseudo check if s is a pseudo-field.
+func isPseudo(s string) bool {
+	_, _, ok := parsePseudo(s)
+	return ok
+}
+
+// looksPseudo check if s is written as pseudo-field like "$TAG" or "$TAG[x]".
+//  Other strings like "$TIMESTAMP" are not pseudo-fields and they are used literally.
+func looksPseudo(s string) bool {
+	return s == PseudoTag || s == PseudoTime || strings.HasPrefix(s, PseudoTag+"[")
+}
+
+// unescapePseudo converts "$$TAG" to "$TAG" to use it literally.
+func unescapePseudo(s string) string {
+	if strings.HasPrefix(s, "$") && looksPseudo(s[1:]) {
+		return s[1:]
+	}
+	return s
+}
+
+// pseudoValue returns the value of pseudo-field s from r.
+func (r *Record) pseudoValue(s string) (interface{}, bool) {
+	name, n, ok := parsePseudo(s)
+	if !ok || r == nil {
+		return nil, false
+	}
+	switch name {
+	case PseudoTag:
+		if n < 0 {
+			return r.Tag, true
+		}
+		parts := strings.Split(r.Tag, ".")
+		if n >= len(parts) {
+			return nil, false
+		}
+		return parts[n], true
+	case PseudoTime:
+		if r.Time.Time.IsZero() {
+			return float64(0), true
+		}
+		return float64(r.Time.Time.UnixNano()) / 1e9, true
+	}
+	return nil, false
+}
@@ -0,0 +1,178 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"go/types"
+	"testing"
+	"time"
+)
+
+func newTestRecord() *Record {
+	return &Record{
+		Tag:  "kube.default.nginx",
+		Time: EventTime{Time: time.Unix(1609556645, 500000000), Ext: true},
+		Map: map[interface{}]interface{}{
+			"kubernetes": map[interface{}]interface{}{"namespace_name": "default"},
+			"$TAG":       "literal",
+			"$TIMESTAMP": "not pseudo",
+			"time":       "2021-01-02T03:04:05.5Z",
+			"count":      uint64(3),
+		},
+	}
+}
+
+func TestGetValueFromRecord(t *testing.T) {
+	type testcase struct {
+		name   string
+		key    interface{}
+		ok     bool
+		expect interface{}
+	}
+	cases := []testcase{
+		{"tag", "$TAG", true, "kube.default.nginx"},
+		{"tag[0]", "$TAG[0]", true, "kube"},
+		{"tag[2]", []interface{}{"$TAG[2]"}, true, "nginx"},
+		{"tag out of range", "$TAG[3]", false, nil},
+		{"time", "$TIME", true, 1609556645.5},
+		{"escaped", "$$TAG", true, "literal"},
+		{"not pseudo", "$TIMESTAMP", true, "not pseudo"},
+		{"nest", []interface{}{"kubernetes", "namespace_name"}, true, "default"},
+	}
+
+	r := newTestRecord()
+	for i, v := range cases {
+		k, err := convertKeys(v.key)
+		if err != nil {
+			t.Errorf("%d:%s convertKeys err:%s", i, v.name, err)
+			continue
+		}
+		ret, ok := k.GetValueFromRecord(r)
+		if ok != v.ok {
+			t.Errorf("%d:%s mismatch\n given :%t\n expect:%t", i, v.name, ok, v.ok)
+		} else if ret != v.expect {
+			t.Errorf("%d:%s mismatch\n given :%v\n expect:%v", i, v.name, ret, v.expect)
+		}
+	}
+}
+
+func TestConvertKeysPseudo(t *testing.T) {
+	ngCases := []interface{}{
+		"$TAG[-1]",
+		"$TAG[a]",
+		[]interface{}{"$TAG", "nest"},
+		[]interface{}{},
+	}
+	for i, v := range ngCases {
+		_, err := convertKeys(v)
+		if err == nil {
+			t.Errorf("%d:%v should be error", i, v)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	r := newTestRecord()
+
+	c, err := NewRefCondition(types.String, CaseEq, "$TAG[1]")
+	if err != nil {
+		t.Fatalf("NewRefCondition err:%s", err)
+	}
+	_, err = c.IsMatch("default")
+	if err == nil {
+		t.Errorf("unresolved condition should be error")
+	}
+	rc, err := c.Resolve(r)
+	if err != nil {
+		t.Fatalf("Resolve err:%s", err)
+	}
+	testMatch(t, &rc, "default", true)
+	testMatch(t, &rc, "kube", false)
+
+	c, err = NewRefCondition(types.Float64, CaseGe, "$TIME")
+	if err != nil {
+		t.Fatalf("NewRefCondition err:%s", err)
+	}
+	rc, err = c.Resolve(r)
+	if err != nil {
+		t.Fatalf("Resolve err:%s", err)
+	}
+	testMatch(t, &rc, 1609556646.0, true)
+	testMatch(t, &rc, 1609556645.0, false)
+
+	c, err = NewRefCondition(types.Int, CaseEq, "$TAG[1]")
+	if err != nil {
+		t.Fatalf("NewRefCondition err:%s", err)
+	}
+	_, err = c.Resolve(r)
+	if err == nil {
+		t.Errorf("converting \"default\" to int should be error")
+	}
+
+	_, err = NewRefCondition(types.Bool, CaseGt, "$TAG")
+	if err == nil {
+		t.Errorf("bool with CaseGt should be error")
+	}
+	_, err = NewRefCondition(types.String, CaseEq, "$TAGS")
+	if err == nil {
+		t.Errorf("invalid pseudo-field should be error")
+	}
+}
+
+func TestSetTypeConditionPseudo(t *testing.T) {
+	cnf := &Config{}
+	cnfl, err := NewConfigLineFromJson(`{"key":["kubernetes","namespace_name"], "condition":"==", "value":"$TAG[1]"}`)
+	if err != nil {
+		t.Fatalf("NewConfigLine err:%s", err)
+	}
+	err = cnf.SetTypeCondition(cnfl, types.String)
+	if err != nil {
+		t.Fatalf("SetTypeCondition err:%s", err)
+	}
+	expect := `"kubernetes"->"namespace_name" == $TAG[1]`
+	if cnf.TypeConditions[0].TypeConditionStr != expect {
+		t.Errorf("mismatch:\n given :%s\n expect:%s", cnf.TypeConditions[0].TypeConditionStr, expect)
+	}
+
+	cnfl, err = NewConfigLineFromJson(`{"key":"$TAG", "condition":"==", "value":"$$TAG"}`)
+	if err != nil {
+		t.Fatalf("NewConfigLine err:%s", err)
+	}
+	err = cnf.SetTypeCondition(cnfl, types.String)
+	if err != nil {
+		t.Fatalf("SetTypeCondition err:%s", err)
+	}
+	tc := cnf.TypeConditions[1]
+	v, ok := tc.Keys.GetValueFromRecord(&Record{Tag: "$TAG"})
+	if !ok {
+		t.Fatalf("$TAG not found")
+	}
+	testMatch(t, &tc.Condition, v, true)
+}
+
+func TestTimeConditionResolve(t *testing.T) {
+	r := newTestRecord()
+	c, err := NewTimeCondition(CaseEq, "$TIME", "", "")
+	if err != nil {
+		t.Fatalf("NewTimeCondition err:%s", err)
+	}
+	rc, err := c.Resolve(r)
+	if err != nil {
+		t.Fatalf("Resolve err:%s", err)
+	}
+	testMatchTime(t, &rc, r.Map["time"], time.Now(), true)
+}
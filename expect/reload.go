@@ -0,0 +1,134 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const ConfigRulesPathKeyName = "rules_path"
+const ConfigReloadIntervalKeyName = "reload_interval"
+const DefaultReloadInterval = 5 * time.Second
+const ConfigReloadOnSighupKeyName = "reload_on_sighup"
+
+// Reloader holds Config which is built from the rules document of path.
+//  The Config is swapped atomically when the document is reloaded.
+//  A caller should get the Config once and use it while checking records.
+type Reloader struct {
+	path  string
+	build func(*RuleDocument) (*Config, error)
+
+	mu      sync.Mutex // serializes Reload
+	cnf     atomic.Value
+	modTime time.Time
+	size    int64
+}
+
+// NewReloader returns Reloader and loads the rules document of path.
+//  build returns a validated Config via the document.
+func NewReloader(path string, build func(*RuleDocument) (*Config, error)) (*Reloader, error) {
+	if path == "" {
+		return nil, errors.New("blank path")
+	}
+	if build == nil {
+		return nil, errors.New("build is nil")
+	}
+	rl := &Reloader{path: path, build: build}
+	if err := rl.Reload(); err != nil {
+		return nil, err
+	}
+	return rl, nil
+}
+
+// Config returns the current Config.
+func (rl *Reloader) Config() *Config {
+	cnf, _ := rl.cnf.Load().(*Config)
+	return cnf
+}
+
+// Reload loads the rules document and swaps Config.
+//  If it fails, the current Config is kept.
+//  The file is not modified for IsModified even if it fails. It is reloaded when it is modified again.
+func (rl *Reloader) Reload() error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	st, err := os.Stat(rl.path)
+	if err != nil {
+		return err
+	}
+	rl.modTime = st.ModTime()
+	rl.size = st.Size()
+	doc, err := LoadRuleDocument(rl.path)
+	if err != nil {
+		return fmt.Errorf("%s:%w", rl.path, err)
+	}
+	cnf, err := rl.build(doc)
+	if err != nil {
+		return fmt.Errorf("%s:%w", rl.path, err)
+	}
+	rl.cnf.Store(cnf)
+	return nil
+}
+
+// IsModified check if the file is modified since the last Reload.
+func (rl *Reloader) IsModified() (bool, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	st, err := os.Stat(rl.path)
+	if err != nil {
+		return false, err
+	}
+	return !st.ModTime().Equal(rl.modTime) || st.Size() != rl.size, nil
+}
+
+// Watch polls the file every interval and reloads it if it is modified.
+//  It also reloads the file when a value is sent to trigger like SIGHUP. trigger can be nil.
+//  The result of each reload is passed to notify. It returns when stop is closed.
+func (rl *Reloader) Watch(interval time.Duration, trigger <-chan os.Signal, stop <-chan struct{}, notify func(error)) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	if notify == nil {
+		notify = func(error) {}
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-trigger:
+			notify(rl.Reload())
+		case <-tick:
+			modified, err := rl.IsModified()
+			if err != nil {
+				notify(err)
+			} else if modified {
+				notify(rl.Reload())
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testBuildConfig(d *RuleDocument) (*Config, error) {
+	cnf := &Config{}
+	err := cnf.ApplyRuleDocument(d)
+	if err != nil {
+		return nil, err
+	}
+	return cnf, cnf.Validate()
+}
+
+func testWriteRules(t *testing.T, path string, body string, mod time.Time) {
+	t.Helper()
+	err := ioutil.WriteFile(path, []byte(body), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile err:%s", err)
+	}
+	err = os.Chtimes(path, mod, mod)
+	if err != nil {
+		t.Fatalf("Chtimes err:%s", err)
+	}
+}
+
+func TestReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "expect")
+	if err != nil {
+		t.Fatalf("TempDir err:%s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rules.json")
+	mod := time.Now().Add(-time.Hour)
+
+	testWriteRules(t, path, `[{"type":"exists", "key":"a"}]`, mod)
+	rl, err := NewReloader(path, testBuildConfig)
+	if err != nil {
+		t.Fatalf("NewReloader err:%s", err)
+	}
+	old := rl.Config()
+	if len(old.Exists) != 1 {
+		t.Fatalf("len(Exists)=%d != 1", len(old.Exists))
+	}
+	if b, err := rl.IsModified(); err != nil || b {
+		t.Errorf("IsModified should be false. err:%v", err)
+	}
+
+	// conflict key. the current Config is kept.
+	mod = mod.Add(time.Minute)
+	testWriteRules(t, path, `[{"type":"exists", "key":"a"},{"type":"not_exists", "key":"a"}]`, mod)
+	if b, err := rl.IsModified(); err != nil || !b {
+		t.Errorf("IsModified should be true. err:%v", err)
+	}
+	if rl.Reload() == nil {
+		t.Errorf("conflict key should be error")
+	}
+	if rl.Config() != old {
+		t.Errorf("Config should be kept")
+	}
+	if b, err := rl.IsModified(); err != nil || b {
+		t.Errorf("failed file should not be reloaded again. err:%v", err)
+	}
+
+	mod = mod.Add(time.Minute)
+	testWriteRules(t, path, `[{"type":"exists", "key":"a"},{"type":"exists", "key":"b"}]`, mod)
+	err = rl.Reload()
+	if err != nil {
+		t.Fatalf("Reload err:%s", err)
+	}
+	if len(rl.Config().Exists) != 2 {
+		t.Errorf("len(Exists)=%d != 2", len(rl.Config().Exists))
+	}
+	if len(old.Exists) != 1 {
+		t.Errorf("old Config should not be changed")
+	}
+	if b, err := rl.IsModified(); err != nil || b {
+		t.Errorf("IsModified should be false. err:%v", err)
+	}
+
+	_, err = NewReloader(filepath.Join(dir, "missing.json"), testBuildConfig)
+	if err == nil {
+		t.Errorf("missing file should be error")
+	}
+}
+
+func TestReloaderWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "expect")
+	if err != nil {
+		t.Fatalf("TempDir err:%s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rules.yaml")
+	mod := time.Now().Add(-time.Hour)
+
+	testWriteRules(t, path, "- type: exists\n  key: a\n", mod)
+	rl, err := NewReloader(path, testBuildConfig)
+	if err != nil {
+		t.Fatalf("NewReloader err:%s", err)
+	}
+
+	trigger := make(chan os.Signal)
+	stop := make(chan struct{})
+	done := make(chan error)
+	go rl.Watch(0, trigger, stop, func(err error) { done <- err })
+
+	testWriteRules(t, path, "- type: not_exists\n  key: a\n", mod)
+	trigger <- os.Interrupt
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("reload err:%s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout")
+	}
+	close(stop)
+
+	if len(rl.Config().NotExists) != 1 {
+		t.Errorf("len(NotExists)=%d != 1", len(rl.Config().NotExists))
+	}
+}
@@ -0,0 +1,188 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// TagPattern represents the pattern of tag.
+//  It is a glob like "kube.*" or a regex enclosed with slashes like "/^kube\.[a-z]+$/".
+type TagPattern struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+// NewTagPattern returns TagPattern via s.
+func NewTagPattern(s string) (*TagPattern, error) {
+	if s == "" {
+		return nil, errors.New("blank string")
+	}
+	var expr string
+	if len(s) >= 2 && strings.HasPrefix(s, "/") && strings.HasSuffix(s, "/") {
+		expr = s[1 : len(s)-1]
+	} else {
+		// glob: "*" matches any characters and "?" matches a character.
+		expr = regexp.QuoteMeta(s)
+		expr = strings.ReplaceAll(expr, `\*`, ".*")
+		expr = strings.ReplaceAll(expr, `\?`, ".")
+		expr = "^" + expr + "$"
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("tag pattern error:%w", err)
+	}
+	return &TagPattern{pattern: s, re: re}, nil
+}
+
+// IsMatch check if tag matches p.
+func (p TagPattern) IsMatch(tag string) bool {
+	if p.re == nil {
+		return false
+	}
+	return p.re.MatchString(tag)
+}
+
+func (p TagPattern) String() string {
+	return p.pattern
+}
+
+const ConfigRuleSetKeyName = "ruleset"
+const ConfigReportUnclassifiedKeyName = "report_unclassified"
+
+// RuleSet represents rules which are applied to the selected records.
+type RuleSet struct {
+	Name string      // blank if it is created by "tag" of rules.
+	Tag  *TagPattern // nil means any tag.
+	When *Config     // nil means any record.
+	Config
+
+	Metadata *Metadata // default metadata of rules of the RuleSet. nil if the ruleset rule has no metadata.
+
+	defined bool
+}
+
+// IsSelected check if r is selected by rs.
+//  now is used by the relative time of When.
+func (rs RuleSet) IsSelected(r *Record, now time.Time) bool {
+	if r == nil {
+		return false
+	}
+	if rs.Tag != nil && !rs.Tag.IsMatch(r.Tag) {
+		return false
+	}
+	return rs.When == nil || rs.When.IsMatch(r, now)
+}
+
+// tagRuleSet returns RuleSet of tag pattern s.
+//  If it is not found, it creates new one.
+func (cnf *Config) tagRuleSet(s string) (*RuleSet, error) {
+	for i := range cnf.RuleSets {
+		if cnf.RuleSets[i].Name == "" && cnf.RuleSets[i].Tag != nil && cnf.RuleSets[i].Tag.String() == s {
+			return &cnf.RuleSets[i], nil
+		}
+	}
+	p, err := NewTagPattern(s)
+	if err != nil {
+		return nil, err
+	}
+	cnf.RuleSets = append(cnf.RuleSets, RuleSet{Tag: p})
+	return &cnf.RuleSets[len(cnf.RuleSets)-1], nil
+}
+
+// namedRuleSet returns RuleSet of name.
+//  If it is not found, it creates new one.
+func (cnf *Config) namedRuleSet(name string) *RuleSet {
+	for i := range cnf.RuleSets {
+		if cnf.RuleSets[i].Name == name {
+			return &cnf.RuleSets[i]
+		}
+	}
+	cnf.RuleSets = append(cnf.RuleSets, RuleSet{Name: name})
+	return &cnf.RuleSets[len(cnf.RuleSets)-1]
+}
+
+// SetRuleSet defines the named RuleSet via c.
+//  "when" of c is a list of rules which have "type". All of them must be matched to select a record.
+func (cnf *Config) SetRuleSet(c *ConfigLine) error {
+	if c == nil {
+		return errors.New("ConfigLine is nil")
+	}
+	if c.ClName == "" {
+		return errors.New("SetRuleSet:blank name")
+	}
+	rs := cnf.namedRuleSet(c.ClName)
+	if rs.defined {
+		return fmt.Errorf("SetRuleSet:%s already defined", c.ClName)
+	}
+	if c.ClTag != "" {
+		p, err := NewTagPattern(c.ClTag)
+		if err != nil {
+			return fmt.Errorf("SetRuleSet:%w", err)
+		}
+		rs.Tag = p
+	}
+	if len(c.ClWhen) > 0 {
+		when := &Config{Definitions: cnf.Definitions}
+		for i := range c.ClWhen {
+			name, err := c.ClWhen[i].RuleName()
+			if err != nil {
+				return fmt.Errorf("SetRuleSet:when[%d]:%w", i, err)
+			}
+			err = when.SetConfigLine(name, &c.ClWhen[i])
+			if err != nil {
+				return fmt.Errorf("SetRuleSet:when[%d]:%w", i, err)
+			}
+		}
+		rs.When = when
+	}
+	rs.Metadata = c.metadata()
+	rs.defined = true
+	return nil
+}
+
+// UndefinedRuleSets returns the names of RuleSets which are used by rules but not defined.
+func (cnf *Config) UndefinedRuleSets() []string {
+	ret := []string{}
+	for _, rs := range cnf.RuleSets {
+		if rs.Name != "" && !rs.defined {
+			ret = append(ret, rs.Name)
+		}
+		ret = append(ret, rs.Config.UndefinedRuleSets()...)
+	}
+	return ret
+}
+
+// IsClassified check if r is selected by any named RuleSet of cnf.
+//  If cnf has no named RuleSet, it returns true.
+func (cnf *Config) IsClassified(r *Record, now time.Time) bool {
+	named := false
+	for _, rs := range cnf.RuleSets {
+		if rs.Name == "" {
+			continue
+		}
+		named = true
+		if rs.IsSelected(r, now) {
+			return true
+		}
+	}
+	return !named
+}
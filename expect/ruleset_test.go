@@ -0,0 +1,217 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTagPattern(t *testing.T) {
+	type testcase struct {
+		pattern string
+		tag     string
+		expect  bool
+	}
+	cases := []testcase{
+		{"kube.*", "kube.default.nginx", true},
+		{"kube.*", "kube", false},
+		{"kube.*", "app.kube.x", false},
+		{"*.nginx", "kube.default.nginx", true},
+		{"app.log?", "app.log1", true},
+		{"app.log?", "app.log10", false},
+		{"app.log", "app.log", true},
+		{"app.log", "appxlog", false},
+		{"/^kube\\.(default|system)\\./", "kube.default.nginx", true},
+		{"/^kube\\.(default|system)\\./", "kube.other.nginx", false},
+	}
+
+	for i, v := range cases {
+		p, err := NewTagPattern(v.pattern)
+		if err != nil {
+			t.Errorf("%d:%s NewTagPattern err:%s", i, v.pattern, err)
+			continue
+		}
+		ret := p.IsMatch(v.tag)
+		if ret != v.expect {
+			t.Errorf("%d:%s %s mismatch\n given :%t\n expect:%t", i, v.pattern, v.tag, ret, v.expect)
+		}
+	}
+
+	ngCases := []string{"", "/(/"}
+	for i, v := range ngCases {
+		_, err := NewTagPattern(v)
+		if err == nil {
+			t.Errorf("%d:%q should be error", i, v)
+		}
+	}
+}
+
+func TestSetConfigLineTag(t *testing.T) {
+	cnf := &Config{}
+	lines := []string{
+		`{"key":"a"}`,
+		`{"key":"b", "tag":"kube.*"}`,
+		`{"key":"c", "tag":"kube.*"}`,
+		`{"key":"d", "tag":"app.*"}`,
+	}
+	for i, v := range lines {
+		cnfl, err := NewConfigLineFromJson(v)
+		if err != nil {
+			t.Fatalf("%d:NewConfigLine err:%s", i, err)
+		}
+		err = cnf.SetConfigLine(ConfigExistKeyName, cnfl)
+		if err != nil {
+			t.Fatalf("%d:SetConfigLine err:%s", i, err)
+		}
+	}
+
+	if len(cnf.Exists) != 1 {
+		t.Errorf("len(cnf.Exists)=%d != 1", len(cnf.Exists))
+	}
+	if len(cnf.RuleSets) != 2 {
+		t.Fatalf("len(cnf.RuleSets)=%d != 2", len(cnf.RuleSets))
+	}
+	rs := cnf.RuleSets[0]
+	if len(rs.Exists) != 2 {
+		t.Errorf("len(rs.Exists)=%d != 2", len(rs.Exists))
+	}
+	if !rs.IsSelected(&Record{Tag: "kube.a"}, time.Now()) {
+		t.Errorf("kube.a should be selected")
+	}
+	if rs.IsSelected(&Record{Tag: "app.a"}, time.Now()) {
+		t.Errorf("app.a should not be selected")
+	}
+
+	cnfl, err := NewConfigLineFromJson(`{"key":"a", "value":1, "condition":"=="}`)
+	if err != nil {
+		t.Fatalf("NewConfigLine err:%s", err)
+	}
+	err = cnf.SetConfigLine("key_unknown", cnfl)
+	if err == nil {
+		t.Errorf("unknown rule should be error")
+	}
+}
+
+func TestSetRuleSet(t *testing.T) {
+	cnf := &Config{}
+	lines := []struct {
+		name string
+		json string
+	}{
+		{ConfigExistKeyName, `{"key":"user", "ruleset":"login"}`},
+		{ConfigRuleSetKeyName, `{"name":"login", "when":[{"type":"str", "key":["event","type"], "condition":"==", "value":"login"}]}`},
+		{ConfigRuleSetKeyName, `{"name":"access", "tag":"app.*", "when":[{"type":"exists", "key":"status"}]}`},
+		{ConfigIntKeyName, `{"key":"status", "condition":"<", "value":500, "ruleset":"access"}`},
+	}
+	for i, v := range lines {
+		cnfl, err := NewConfigLineFromJson(v.json)
+		if err != nil {
+			t.Fatalf("%d:NewConfigLine err:%s", i, err)
+		}
+		err = cnf.SetConfigLine(v.name, cnfl)
+		if err != nil {
+			t.Fatalf("%d:SetConfigLine err:%s", i, err)
+		}
+	}
+	if len(cnf.RuleSets) != 2 {
+		t.Fatalf("len(cnf.RuleSets)=%d != 2", len(cnf.RuleSets))
+	}
+	if len(cnf.UndefinedRuleSets()) != 0 {
+		t.Errorf("undefined rule sets: %v", cnf.UndefinedRuleSets())
+	}
+
+	now := time.Now()
+	login := &Record{Tag: "app.log", Map: map[interface{}]interface{}{
+		"event": map[interface{}]interface{}{"type": "login"},
+	}}
+	access := &Record{Tag: "app.log", Map: map[interface{}]interface{}{"status": uint64(200)}}
+	other := &Record{Tag: "sys.log", Map: map[interface{}]interface{}{"status": uint64(200)}}
+
+	if !cnf.RuleSets[0].IsSelected(login, now) || cnf.RuleSets[0].IsSelected(access, now) {
+		t.Errorf("login selector mismatch")
+	}
+	if !cnf.RuleSets[1].IsSelected(access, now) || cnf.RuleSets[1].IsSelected(other, now) {
+		t.Errorf("access selector mismatch")
+	}
+	if !cnf.IsClassified(login, now) || !cnf.IsClassified(access, now) || cnf.IsClassified(other, now) {
+		t.Errorf("classification mismatch")
+	}
+
+	// "user" of login event is missing.
+	if cnf.IsMatch(login, now) {
+		t.Errorf("login record should not match")
+	}
+	if !cnf.IsMatch(access, now) {
+		t.Errorf("access record should match")
+	}
+
+	cnfl, err := NewConfigLineFromJson(`{"name":"login"}`)
+	if err != nil {
+		t.Fatalf("NewConfigLine err:%s", err)
+	}
+	err = cnf.SetRuleSet(cnfl)
+	if err == nil {
+		t.Errorf("defining twice should be error")
+	}
+	cnfl, err = NewConfigLineFromJson(`{"name":"bad", "when":[{"type":"integer", "key":"a", "condition":"==", "value":1}]}`)
+	if err != nil {
+		t.Fatalf("NewConfigLine err:%s", err)
+	}
+	err = cnf.SetRuleSet(cnfl)
+	if err == nil {
+		t.Errorf("unknown type should be error")
+	}
+}
+
+func TestUndefinedRuleSets(t *testing.T) {
+	cnf := &Config{}
+	cnfl, err := NewConfigLineFromJson(`{"key":"user", "ruleset":"login"}`)
+	if err != nil {
+		t.Fatalf("NewConfigLine err:%s", err)
+	}
+	err = cnf.SetConfigLine(ConfigExistKeyName, cnfl)
+	if err != nil {
+		t.Fatalf("SetConfigLine err:%s", err)
+	}
+	ret := cnf.UndefinedRuleSets()
+	if len(ret) != 1 || ret[0] != "login" {
+		t.Errorf("mismatch:\n given :%v\n expect:[login]", ret)
+	}
+}
+
+func TestRuleNameOfType(t *testing.T) {
+	cases := map[string]string{
+		"exists":     ConfigExistKeyName,
+		"not_exists": ConfigNotExistKeyName,
+		"int":        ConfigIntKeyName,
+		"event_time": ConfigEventTimeKeyName,
+		"ruleset":    ConfigRuleSetKeyName,
+	}
+	for k, v := range cases {
+		ret, err := RuleNameOfType(k)
+		if err != nil {
+			t.Errorf("%s err:%s", k, err)
+		} else if ret != v {
+			t.Errorf("%s mismatch:\n given :%s\n expect:%s", k, ret, v)
+		}
+	}
+	_, err := RuleNameOfType("integer")
+	if err == nil {
+		t.Errorf("unknown type should be error")
+	}
+}
@@ -0,0 +1,205 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const templateFilePrefix = "@file:"
+
+// Template expands "${ENV}" and "@file:path" of rule values.
+type Template struct {
+	LookupEnv func(string) (string, bool)
+	ReadFile  func(string) ([]byte, error)
+}
+
+// NewTemplate returns Template which reads environment variables and files.
+func NewTemplate() *Template {
+	return &Template{LookupEnv: os.LookupEnv, ReadFile: ioutil.ReadFile}
+}
+
+// isTemplate check if s has "${" or starts with "@file:".
+func isTemplate(s string) bool {
+	return strings.Contains(s, "${") || strings.HasPrefix(s, templateFilePrefix) || strings.HasPrefix(s, "@"+templateFilePrefix)
+}
+
+func isEnvName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_', 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z':
+		case '0' <= r && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// expandEnv replaces "${NAME}" of s with the environment variable.
+//  "$${" is replaced with "${".
+func (t *Template) expandEnv(s string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1] + "${")
+			s = s[i+2:]
+			continue
+		}
+		b.WriteString(s[:i])
+		end := strings.Index(s[i:], "}")
+		if end < 0 {
+			return "", fmt.Errorf("unclosed variable:%s", s[i:])
+		}
+		name := s[i+2 : i+end]
+		if !isEnvName(name) {
+			return "", fmt.Errorf("invalid variable name:%q", name)
+		}
+		v, ok := t.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("undefined variable:%s", name)
+		}
+		b.WriteString(v)
+		s = s[i+end+1:]
+	}
+}
+
+// Expand returns s whose "${NAME}" is replaced with the environment variable.
+//  If s starts with "@file:", it returns the content of the file without trailing newlines.
+//  "$${" and "@@file:" are used to write them literally.
+func (t *Template) Expand(s string) (string, error) {
+	if strings.HasPrefix(s, "@"+templateFilePrefix) {
+		return t.expandEnv(s[1:])
+	}
+	if !strings.HasPrefix(s, templateFilePrefix) {
+		return t.expandEnv(s)
+	}
+
+	path, err := t.expandEnv(s[len(templateFilePrefix):])
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		return "", errors.New("blank file path")
+	}
+	b, err := t.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// ExpandConfigLine expands the value of c which is the rule name.
+//  The expanded value of key_int, key_uint and key_double is converted to a number
+//  and the one of key_bool is converted to bool. An integer is json.Number to keep the precision.
+//  Rules of "when" are also expanded.
+func (t *Template) ExpandConfigLine(name string, c *ConfigLine) error {
+	if c == nil {
+		return errors.New("ConfigLine is nil")
+	}
+	if s, ok := c.ClValue.(string); ok && isTemplate(s) {
+		v, err := t.Expand(s)
+		if err != nil {
+			return fmt.Errorf("template error:%w", err)
+		}
+		c.ClValue = v
+		switch name {
+		case ConfigIntKeyName, ConfigUintKeyName, ConfigDoubleKeyName:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("template error:%s is not a number:%q", s, v)
+			}
+			c.ClValue = f
+			if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+				c.ClValue = json.Number(strconv.FormatInt(i, 10))
+			} else if u, err := strconv.ParseUint(v, 10, 64); err == nil {
+				c.ClValue = json.Number(strconv.FormatUint(u, 10))
+			}
+		case ConfigBoolKeyName:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("template error:%s is not a bool:%q", s, v)
+			}
+			c.ClValue = b
+		}
+	}
+
+	for i := range c.ClWhen {
+		wname, err := c.ClWhen[i].RuleName()
+		if err != nil {
+			// SetRuleSet reports it.
+			continue
+		}
+		err = t.ExpandConfigLine(wname, &c.ClWhen[i])
+		if err != nil {
+			return fmt.Errorf("when[%d]:%w", i, err)
+		}
+	}
+	return nil
+}
+
+// ExpandRuleDocument expands values of all rules of d and its templates.
+func (t *Template) ExpandRuleDocument(d *RuleDocument) error {
+	if d == nil {
+		return errors.New("RuleDocument is nil")
+	}
+	for i := range d.Rules {
+		name, err := d.Rules[i].RuleName()
+		if err != nil {
+			return fmt.Errorf("rules[%d]:%w", i, err)
+		}
+		err = t.ExpandConfigLine(name, &d.Rules[i])
+		if err != nil {
+			return fmt.Errorf("rules[%d]:%w", i, err)
+		}
+	}
+	return t.ExpandDefinitions(d)
+}
+
+// ExpandDefinitions expands values of rules of templates of d.
+func (t *Template) ExpandDefinitions(d *RuleDocument) error {
+	if d == nil {
+		return errors.New("RuleDocument is nil")
+	}
+	for tname, lines := range d.Templates {
+		for i := range lines {
+			name, err := lines[i].RuleName()
+			if err != nil {
+				return fmt.Errorf("template %s[%d]:%w", tname, i, err)
+			}
+			err = t.ExpandConfigLine(name, &lines[i])
+			if err != nil {
+				return fmt.Errorf("template %s[%d]:%w", tname, i, err)
+			}
+		}
+	}
+	return nil
+}
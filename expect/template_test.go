@@ -0,0 +1,150 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func newTestTemplate() *Template {
+	env := map[string]string{
+		"CLUSTER": "prod",
+		"REGION":  "ap-northeast-1",
+		"MAX":     "500",
+		"BIG":     "9007199254740993",
+		"DEBUG":   "false",
+		"DIR":     "/etc/expect",
+	}
+	files := map[string]string{
+		"/etc/expect/hostname": "web01.example.com\n",
+	}
+	return &Template{
+		LookupEnv: func(s string) (string, bool) {
+			v, ok := env[s]
+			return v, ok
+		},
+		ReadFile: func(s string) ([]byte, error) {
+			v, ok := files[s]
+			if !ok {
+				return nil, errors.New("not found:" + s)
+			}
+			return []byte(v), nil
+		},
+	}
+}
+
+func TestTemplateExpand(t *testing.T) {
+	tmpl := newTestTemplate()
+	type testcase struct {
+		input  string
+		expect string
+	}
+	cases := []testcase{
+		{"${CLUSTER}", "prod"},
+		{"${CLUSTER}-${REGION}.example.com", "prod-ap-northeast-1.example.com"},
+		{"no template", "no template"},
+		{"$${CLUSTER}", "${CLUSTER}"},
+		{"$TAG[1]", "$TAG[1]"},
+		{"@file:${DIR}/hostname", "web01.example.com"},
+		{"@@file:${DIR}", "@file:/etc/expect"},
+	}
+	for i, v := range cases {
+		ret, err := tmpl.Expand(v.input)
+		if err != nil {
+			t.Errorf("%d:%s err:%s", i, v.input, err)
+		} else if ret != v.expect {
+			t.Errorf("%d mismatch:\n given :%s\n expect:%s", i, ret, v.expect)
+		}
+	}
+
+	ngCases := map[string]string{
+		"${UNDEFINED}":       "undefined variable:UNDEFINED",
+		"${CLUSTER":          "unclosed variable:${CLUSTER",
+		"${1A}":              `invalid variable name:"1A"`,
+		"@file:/etc/missing": "not found:/etc/missing",
+		"@file:":             "blank file path",
+	}
+	for input, expect := range ngCases {
+		_, err := tmpl.Expand(input)
+		if err == nil {
+			t.Errorf("%s should be error", input)
+		} else if err.Error() != expect {
+			t.Errorf("%s mismatch:\n given :%s\n expect:%s", input, err, expect)
+		}
+	}
+}
+
+func TestTemplateExpandConfigLine(t *testing.T) {
+	tmpl := newTestTemplate()
+	d, err := NewRuleDocumentFromJson([]byte(`[
+	  {"type":"str", "key":"cluster_name", "condition":"==", "value":"${CLUSTER}"},
+	  {"type":"int", "key":"latency", "condition":"<", "value":"${MAX}"},
+	  {"type":"bool", "key":"debug", "condition":"==", "value":"${DEBUG}"},
+	  {"type":"ruleset", "name":"web", "when":[{"type":"str", "key":"host", "condition":"==", "value":"@file:${DIR}/hostname"}]}
+	]`))
+	if err != nil {
+		t.Fatalf("NewRuleDocumentFromJson err:%s", err)
+	}
+	err = tmpl.ExpandRuleDocument(d)
+	if err != nil {
+		t.Fatalf("ExpandRuleDocument err:%s", err)
+	}
+	if d.Rules[0].ClValue != "prod" {
+		t.Errorf("str mismatch:%v", d.Rules[0].ClValue)
+	}
+	if d.Rules[1].ClValue != json.Number("500") {
+		t.Errorf("int mismatch:%v", d.Rules[1].ClValue)
+	}
+	if d.Rules[2].ClValue != false {
+		t.Errorf("bool mismatch:%v", d.Rules[2].ClValue)
+	}
+	if d.Rules[3].ClWhen[0].ClValue != "web01.example.com" {
+		t.Errorf("when mismatch:%v", d.Rules[3].ClWhen[0].ClValue)
+	}
+
+	cnf := &Config{}
+	err = cnf.ApplyRuleDocument(d)
+	if err != nil {
+		t.Fatalf("ApplyRuleDocument err:%s", err)
+	}
+
+	line := &ConfigLine{ClKey: "a", ClCondition: "<", ClValue: "${CLUSTER}"}
+	err = tmpl.ExpandConfigLine(ConfigIntKeyName, line)
+	if err == nil {
+		t.Errorf("not a number should be error")
+	}
+	line = &ConfigLine{ClKey: "a", ClCondition: "==", ClValue: "${UNDEFINED}"}
+	err = tmpl.ExpandConfigLine(ConfigStrKeyName, line)
+	expect := "template error:undefined variable:UNDEFINED"
+	if err == nil || err.Error() != expect {
+		t.Errorf("mismatch:\n given :%v\n expect:%s", err, expect)
+	}
+
+	lines, err := ParseRules(`$latency int < ${MAX}; $cluster_name str == ${CLUSTER}`)
+	if err != nil {
+		t.Fatalf("ParseRules err:%s", err)
+	}
+	err = tmpl.ExpandRuleDocument(&RuleDocument{Rules: lines})
+	if err != nil {
+		t.Fatalf("ExpandRuleDocument err:%s", err)
+	}
+	if lines[0].ClValue != json.Number("500") || lines[1].ClValue != "prod" {
+		t.Errorf("DSL mismatch:%+v", lines)
+	}
+}
@@ -0,0 +1,113 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const ConfigTestRecordsKeyName = "test_records"
+const ConfigTestTimeoutKeyName = "test_timeout"
+
+// TestRun counts checked records in test mode.
+//  The test finishes when MaxRecords records are checked or Finish is called.
+type TestRun struct {
+	MaxRecords int // 0 means no limit.
+
+	mu            sync.Mutex
+	records       int
+	failedRecords int
+	failures      map[Severity]int
+	done          bool
+}
+
+// NewTestRun returns TestRun which finishes after maxRecords records.
+func NewTestRun(maxRecords int) *TestRun {
+	return &TestRun{MaxRecords: maxRecords, failures: map[Severity]int{}}
+}
+
+// Add counts a record. severities are the ones of failed rules of the record.
+//  It returns true if the record is the last one of MaxRecords. Records after the test finished are ignored.
+func (t *TestRun) Add(severities ...Severity) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return false
+	}
+	t.records++
+	if len(severities) > 0 {
+		t.failedRecords++
+	}
+	for _, s := range severities {
+		t.failures[s]++
+	}
+	return t.MaxRecords > 0 && t.records >= t.MaxRecords
+}
+
+// Finish finishes the test. It returns false if the test is already finished.
+func (t *TestRun) Finish() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return false
+	}
+	t.done = true
+	return true
+}
+
+// Passed check if no rule failed.
+//  The test also fails if no record is checked or MaxRecords records are not checked.
+func (t *TestRun) Passed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.passed()
+}
+
+func (t *TestRun) passed() bool {
+	if t.records == 0 || t.records < t.MaxRecords {
+		return false
+	}
+	return t.failedRecords == 0
+}
+
+// Summary returns the result of the test. e.g.
+//  FAIL records=10 failed_records=2 failures={error=2,warning=1}
+func (t *TestRun) Summary() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := "FAIL"
+	if t.passed() {
+		result = "PASS"
+	}
+	records := fmt.Sprintf("%d", t.records)
+	if t.MaxRecords > 0 {
+		records = fmt.Sprintf("%d/%d", t.records, t.MaxRecords)
+	}
+	sevs := []int{}
+	for s := range t.failures {
+		sevs = append(sevs, int(s))
+	}
+	sort.Ints(sevs)
+	ss := make([]string, len(sevs))
+	for i, s := range sevs {
+		ss[i] = fmt.Sprintf("%s=%d", Severity(s), t.failures[Severity(s)])
+	}
+	return fmt.Sprintf("%s records=%s failed_records=%d failures={%s}", result, records, t.failedRecords, strings.Join(ss, ","))
+}
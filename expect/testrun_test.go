@@ -0,0 +1,75 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"testing"
+)
+
+func TestTestRun(t *testing.T) {
+	type testcase struct {
+		name       string
+		maxRecords int
+		records    [][]Severity
+		done       bool
+		passed     bool
+		summary    string
+	}
+
+	cases := []testcase{
+		{"pass", 2, [][]Severity{nil, nil}, true, true, "PASS records=2/2 failed_records=0 failures={}"},
+		{"not reached", 3, [][]Severity{nil}, false, false, "FAIL records=1/3 failed_records=0 failures={}"},
+		{"no record", 0, [][]Severity{}, false, false, "FAIL records=0 failed_records=0 failures={}"},
+		{"no limit pass", 0, [][]Severity{nil}, false, true, "PASS records=1 failed_records=0 failures={}"},
+		{"no limit", 0, [][]Severity{nil, {SeverityWarning}}, false, false, "FAIL records=2 failed_records=1 failures={warning=1}"},
+		{"fail", 3, [][]Severity{{SeverityError, SeverityWarning}, nil, {SeverityError}}, true, false,
+			"FAIL records=3/3 failed_records=2 failures={warning=1,error=2}"},
+	}
+
+	for _, v := range cases {
+		tr := NewTestRun(v.maxRecords)
+		done := false
+		for _, sevs := range v.records {
+			done = tr.Add(sevs...)
+		}
+		if done != v.done {
+			t.Errorf("%s: done mismatch given:%t expect:%t", v.name, done, v.done)
+		}
+		if tr.Passed() != v.passed {
+			t.Errorf("%s: passed mismatch given:%t expect:%t", v.name, tr.Passed(), v.passed)
+		}
+		if s := tr.Summary(); s != v.summary {
+			t.Errorf("%s: summary mismatch\n given :%s\n expect:%s", v.name, s, v.summary)
+		}
+	}
+}
+
+func TestTestRunFinish(t *testing.T) {
+	tr := NewTestRun(1)
+	if !tr.Finish() {
+		t.Errorf("first Finish should be true")
+	}
+	if tr.Finish() {
+		t.Errorf("second Finish should be false")
+	}
+	if tr.Add(SeverityError) {
+		t.Errorf("Add after Finish should be false")
+	}
+	if s := tr.Summary(); s != "FAIL records=0/1 failed_records=0 failures={}" {
+		t.Errorf("record after Finish should be ignored. summary=%s", s)
+	}
+}
@@ -0,0 +1,327 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ConfigTimeKeyName = "key_time"
+
+// Special layouts for epoch time.
+const (
+	LayoutEpoch   = "epoch"    // seconds
+	LayoutEpochMs = "epoch_ms" // milliseconds
+	LayoutEpochUs = "epoch_us" // microseconds
+	LayoutEpochNs = "epoch_ns" // nanoseconds
+)
+
+// TimeCondition represents condition of time.
+//  The value is an absolute time or a time relative to now.
+type TimeCondition struct {
+	ccase    int
+	layout   string
+	loc      *time.Location
+	abs      time.Time
+	offset   time.Duration
+	relative bool
+	ref      string // pseudo-field which is resolved via Record
+}
+
+// KeyTimeCondition represents key_time configuration.
+type KeyTimeCondition struct {
+	Keys             Keys
+	Condition        TimeCondition
+	TimeConditionStr string
+	Metadata         *Metadata // nil if the rule has no metadata.
+	param            string    // see ConfigLine.ClParam
+}
+
+// epochUnit returns the unit of epoch layout.
+//  If layout is not epoch, it returns 0.
+func epochUnit(layout string) time.Duration {
+	switch layout {
+	case LayoutEpoch:
+		return time.Second
+	case LayoutEpochMs:
+		return time.Millisecond
+	case LayoutEpochUs:
+		return time.Microsecond
+	case LayoutEpochNs:
+		return time.Nanosecond
+	}
+	return 0
+}
+
+func epochToTime(f float64, unit time.Duration) time.Time {
+	sec, frac := math.Modf(f * float64(unit) / float64(time.Second))
+	return time.Unix(int64(sec), int64(frac*float64(time.Second)))
+}
+
+// parseTime converts v to time.Time.
+//  A number is treated as epoch. Its unit is seconds unless layout is epoch_ms, epoch_us or epoch_ns.
+//  A string is parsed by layout in loc. If layout is "", time.RFC3339Nano is used.
+func parseTime(v interface{}, layout string, loc *time.Location) (time.Time, error) {
+	unit := epochUnit(layout)
+	if unit == 0 {
+		unit = time.Second
+	}
+
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case []byte:
+		return parseTime(string(t), layout, loc)
+	case string:
+		if epochUnit(layout) != 0 {
+			f, err := strconv.ParseFloat(t, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("epoch %w: %s", ErrParse, t)
+			}
+			return epochToTime(f, unit), nil
+		}
+		if layout == "" {
+			layout = time.RFC3339Nano
+		}
+		if loc == nil {
+			loc = time.UTC
+		}
+		ret, err := time.ParseInLocation(layout, t, loc)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%w:%s", ErrParse, err)
+		}
+		return ret, nil
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return parseTime(i, layout, loc)
+		}
+		f, err := t.Float64()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("epoch %w: %s", ErrParse, t)
+		}
+		return epochToTime(f, unit), nil
+	case float64:
+		return epochToTime(t, unit), nil
+	case float32:
+		return epochToTime(float64(t), unit), nil
+	case int64:
+		return time.Unix(0, 0).Add(time.Duration(t) * unit), nil
+	case int32:
+		return time.Unix(0, 0).Add(time.Duration(t) * unit), nil
+	case int16:
+		return time.Unix(0, 0).Add(time.Duration(t) * unit), nil
+	case int8:
+		return time.Unix(0, 0).Add(time.Duration(t) * unit), nil
+	case int:
+		return time.Unix(0, 0).Add(time.Duration(t) * unit), nil
+	case uint64:
+		return time.Unix(0, 0).Add(time.Duration(t) * unit), nil
+	case uint32:
+		return time.Unix(0, 0).Add(time.Duration(t) * unit), nil
+	case uint16:
+		return time.Unix(0, 0).Add(time.Duration(t) * unit), nil
+	case uint8:
+		return time.Unix(0, 0).Add(time.Duration(t) * unit), nil
+	case uint:
+		return time.Unix(0, 0).Add(time.Duration(t) * unit), nil
+	}
+	return time.Time{}, fmt.Errorf("%w: type=%T v=%v", ErrTypeMismatch, v, v)
+}
+
+// parseRelative parses s like "now", "now-10m", "-10m" or "+30s".
+func parseRelative(s string) (time.Duration, bool) {
+	s = strings.TrimSpace(s)
+	if s == "now" {
+		return 0, true
+	}
+	s = strings.TrimPrefix(s, "now")
+	if !strings.HasPrefix(s, "-") && !strings.HasPrefix(s, "+") {
+		return 0, false
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, false
+	}
+	return d, true
+}
+
+// NewTimeCondition returns TimeCondition c.
+//  c must be CaseEq, CaseNe CaseGt, CaseGe, CaseLt or CaseLe.
+//  v is a relative time like "now-10m" or an absolute time which is parsed by layout in timezone tz.
+func NewTimeCondition(c int, v interface{}, layout string, tz string) (*TimeCondition, error) {
+	if c != CaseEq && c != CaseNe && c != CaseGt && c != CaseGe && c != CaseLt && c != CaseLe {
+		return nil, ErrInvalidCondition
+	}
+	loc := time.UTC
+	if tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("timezone error:%w", err)
+		}
+		loc = l
+	}
+	ret := &TimeCondition{ccase: c, layout: layout, loc: loc}
+
+	s, isStr := v.(string)
+	if isStr && looksPseudo(s) {
+		if !isPseudo(s) {
+			return nil, fmt.Errorf("invalid pseudo-field:%s", s)
+		}
+		ret.ref = s
+		return ret, nil
+	}
+	if isStr {
+		ret.offset, ret.relative = parseRelative(s)
+		if ret.relative {
+			return ret, nil
+		}
+	}
+	t, err := parseTime(v, layout, loc)
+	if err != nil && isStr {
+		// absolute time can be also written in RFC3339
+		t, err = parseTime(s, "", loc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("time value parse error:%v", v)
+	}
+	ret.abs = t
+
+	return ret, nil
+}
+
+// Resolve returns TimeCondition whose pseudo-field value is resolved via r.
+//  If c has no pseudo-field, it returns c.
+func (c TimeCondition) Resolve(r *Record) (TimeCondition, error) {
+	if c.ref == "" {
+		return c, nil
+	}
+	ret := c
+	ret.ref = ""
+	if c.ref == PseudoTime && r != nil {
+		ret.abs = r.Time.Time
+		return ret, nil
+	}
+	v, ok := r.pseudoValue(c.ref)
+	if !ok {
+		return c, fmt.Errorf("%s %w", c.ref, ErrKeyNotFound)
+	}
+	t, err := parseTime(v, c.layout, c.loc)
+	if err != nil {
+		return c, fmt.Errorf("%s parse error:%w", c.ref, err)
+	}
+	ret.abs = t
+
+	return ret, nil
+}
+
+// base returns the time which is compared with.
+func (c TimeCondition) base(now time.Time) time.Time {
+	if c.relative {
+		return now.Add(c.offset)
+	}
+	return c.abs
+}
+
+// IsMatch check if v matches condition.
+//  now is used as the base of relative time.
+func (c TimeCondition) IsMatch(v interface{}, now time.Time) (bool, error) {
+	if v == nil {
+		return false, ErrValueIsNil
+	}
+	if c.ref != "" {
+		return false, fmt.Errorf("%w:%s", ErrUnresolved, c.ref)
+	}
+	t, err := parseTime(v, c.layout, c.loc)
+	if err != nil {
+		return false, err
+	}
+	b := c.base(now)
+
+	switch c.ccase {
+	case CaseGt:
+		return t.After(b), nil
+	case CaseGe:
+		return !t.Before(b), nil
+	case CaseLt:
+		return t.Before(b), nil
+	case CaseLe:
+		return !t.After(b), nil
+	case CaseEq:
+		return t.Equal(b), nil
+	case CaseNe:
+		return !t.Equal(b), nil
+	}
+	return false, nil
+}
+
+func (c TimeCondition) String() string {
+	ret := IntCase2Str(c.ccase) + " "
+	if c.ref != "" {
+		return ret + c.ref
+	}
+	if c.relative {
+		ret += "now"
+		if c.offset >= 0 {
+			ret += "+"
+		}
+		return ret + c.offset.String()
+	}
+	return ret + c.abs.Format(time.RFC3339Nano)
+}
+
+// Compare compares c and ic.
+func (c TimeCondition) Compare(ic TimeCondition) bool {
+	if c.ccase != ic.ccase || c.layout != ic.layout || c.relative != ic.relative || c.ref != ic.ref {
+		return false
+	}
+	if c.loc.String() != ic.loc.String() {
+		return false
+	}
+	if c.relative {
+		return c.offset == ic.offset
+	}
+	return c.abs.Equal(ic.abs)
+}
+
+// SetTimeCondition set time condition via c.
+func (cnf *Config) SetTimeCondition(c *ConfigLine) error {
+	if c == nil {
+		return errors.New("ConfigLine is nil")
+	}
+	k, err := convertKeys(c.ClKey)
+	if err != nil {
+		return fmt.Errorf("SetTimeCondition:%w", err)
+	}
+	cnd, err := NewTimeCondition(Str2IntCase(c.ClCondition), c.ClValue, c.ClLayout, c.ClTimezone)
+	if err != nil {
+		return fmt.Errorf("NewTimeCondition err:%w", err)
+	}
+	tc := &KeyTimeCondition{Keys: *k, Condition: *cnd, Metadata: c.metadata(), param: c.ClParam}
+	tc.TimeConditionStr = tc.String()
+	cnf.TimeConditions = append(cnf.TimeConditions, *tc)
+	return nil
+}
+
+func (tc KeyTimeCondition) String() string {
+	return fmt.Sprintf("%s %s", tc.Keys.String(), tc.Condition.String())
+}
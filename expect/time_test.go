@@ -0,0 +1,215 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	type testcase struct {
+		name   string
+		input  interface{}
+		layout string
+		expect time.Time
+	}
+	base := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	cases := []testcase{
+		{"rfc3339", "2021-01-02T03:04:05Z", "", base},
+		{"rfc3339 offset", "2021-01-02T12:04:05+09:00", "", base},
+		{"byte slice", []byte("2021-01-02T03:04:05Z"), "", base},
+		{"layout", "2021/01/02 03:04:05", "2006/01/02 15:04:05", base},
+		{"epoch uint", uint64(base.Unix()), "", base},
+		{"epoch int", int64(base.Unix()), "", base},
+		{"epoch float", float64(base.Unix()) + 0.5, "", base.Add(500 * time.Millisecond)},
+		{"epoch string", "1609556645", LayoutEpoch, base},
+		{"epoch_ms", int64(base.Unix()) * 1000, LayoutEpochMs, base},
+		{"epoch_ms string", "1609556645000", LayoutEpochMs, base},
+		{"epoch_ns", base.UnixNano(), LayoutEpochNs, base},
+	}
+
+	for i, v := range cases {
+		ret, err := parseTime(v.input, v.layout, time.UTC)
+		if err != nil {
+			t.Errorf("%d:%s error=%s", i, v.name, err)
+		} else if !ret.Equal(v.expect) {
+			t.Errorf("%d:%s mismatch:\n given :%s\n expect:%s", i, v.name, ret, v.expect)
+		}
+	}
+
+	_, err := parseTime("2021-01-02", "", time.UTC)
+	if err == nil {
+		t.Errorf("layout mismatch should be error")
+	}
+	_, err = parseTime(true, "", time.UTC)
+	if err == nil {
+		t.Errorf("bool should be error")
+	}
+}
+
+func TestParseTimeLocation(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("LoadLocation err:%s", err)
+	}
+	ret, err := parseTime("2021/01/02 12:04:05", "2006/01/02 15:04:05", loc)
+	if err != nil {
+		t.Fatalf("parseTime err:%s", err)
+	}
+	expect := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	if !ret.Equal(expect) {
+		t.Errorf("mismatch:\n given :%s\n expect:%s", ret, expect)
+	}
+}
+
+func testMatchTime(t *testing.T, c *TimeCondition, v interface{}, now time.Time, e bool) {
+	t.Helper()
+
+	b, err := c.IsMatch(v, now)
+	if err != nil {
+		t.Errorf("IsMatch err:%s", err)
+	} else if b != e {
+		t.Errorf("ret mismatch\n given :%t\n expect:%t", b, e)
+	}
+}
+
+func TestMatchTimeRelative(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// not older than 10m
+	c, err := NewTimeCondition(CaseGe, "now-10m", "", "")
+	if err != nil {
+		t.Fatalf("NewTimeCondition err:%s", err)
+	}
+	testMatchTime(t, c, "2021-01-02T03:00:00Z", now, true)
+	testMatchTime(t, c, "2021-01-02T02:50:00Z", now, false)
+
+	// not in the future by more than 30s
+	c, err = NewTimeCondition(CaseLe, "+30s", "", "")
+	if err != nil {
+		t.Fatalf("NewTimeCondition err:%s", err)
+	}
+	testMatchTime(t, c, "2021-01-02T03:04:35Z", now, true)
+	testMatchTime(t, c, "2021-01-02T03:04:36Z", now, false)
+	testMatchTime(t, c, float64(now.Unix()), now, true)
+}
+
+func TestMatchTimeAbsolute(t *testing.T) {
+	c, err := NewTimeCondition(CaseLt, "2021-01-02T03:04:05Z", "", "")
+	if err != nil {
+		t.Fatalf("NewTimeCondition err:%s", err)
+	}
+	testMatchTime(t, c, "2021-01-02T03:04:04Z", time.Now(), true)
+	testMatchTime(t, c, "2021-01-02T03:04:05Z", time.Now(), false)
+
+	c, err = NewTimeCondition(CaseEq, 1609556645, LayoutEpoch, "")
+	if err != nil {
+		t.Fatalf("NewTimeCondition err:%s", err)
+	}
+	testMatchTime(t, c, uint64(1609556645), time.Now(), true)
+	testMatchTime(t, c, "1609556645", time.Now(), true)
+	testMatchTime(t, c, "1609556646", time.Now(), false)
+
+	_, err = c.IsMatch("2021-01-02T03:04:05Z", time.Now())
+	if err == nil {
+		t.Errorf("not epoch string should be error")
+	}
+}
+
+func TestNewTimeCondition(t *testing.T) {
+	type testcase struct {
+		name      string
+		inputCase int
+		inputVal  interface{}
+		layout    string
+		tz        string
+	}
+
+	okCases := []testcase{
+		{"now", CaseGe, "now", "", ""},
+		{"relative", CaseGe, "now-10m", "", ""},
+		{"relative without now", CaseLe, "+30s", "", ""},
+		{"rfc3339", CaseGt, "2021-01-02T03:04:05Z", "", ""},
+		{"rfc3339 with layout", CaseGt, "2021-01-02T03:04:05Z", "2006/01/02", ""},
+		{"layout", CaseGt, "2021/01/02", "2006/01/02", "UTC"},
+		{"epoch", CaseGt, 1609556645.0, LayoutEpoch, ""},
+	}
+	for i, v := range okCases {
+		_, err := NewTimeCondition(v.inputCase, v.inputVal, v.layout, v.tz)
+		if err != nil {
+			t.Errorf("%d:%s error=%s", i, v.name, err)
+		}
+	}
+
+	ngCases := []testcase{
+		{"contains", CaseContains, "now", "", ""},
+		{"invalid duration", CaseGe, "now-10x", "", ""},
+		{"invalid time", CaseGe, "yesterday", "", ""},
+		{"bool", CaseGe, true, "", ""},
+		{"invalid timezone", CaseGe, "now", "", "Nowhere/Unknown"},
+	}
+	for i, v := range ngCases {
+		_, err := NewTimeCondition(v.inputCase, v.inputVal, v.layout, v.tz)
+		if err == nil {
+			t.Errorf("%d:%s should be error", i, v.name)
+		}
+	}
+}
+
+func TestTimeConditionCompare(t *testing.T) {
+	c, err := NewTimeCondition(CaseGe, "now-10m", "", "")
+	if err != nil {
+		t.Fatalf("NewTimeCondition err:%s", err)
+	}
+	cc, err := NewTimeCondition(CaseGe, "-10m", "", "")
+	if err != nil {
+		t.Fatalf("NewTimeCondition err:%s", err)
+	}
+	if !c.Compare(*cc) {
+		t.Errorf("should be true")
+	}
+
+	cc, err = NewTimeCondition(CaseGe, "-5m", "", "")
+	if err != nil {
+		t.Fatalf("NewTimeCondition err:%s", err)
+	}
+	if c.Compare(*cc) {
+		t.Errorf("should be false")
+	}
+}
+
+func TestSetTimeCondition(t *testing.T) {
+	cnf := &Config{}
+	cnfl, err := NewConfigLineFromJson(`{"key":"time","condition":">=","value":"now-10m","layout":"2006-01-02 15:04:05","timezone":"UTC"}`)
+	if err != nil {
+		t.Fatalf("NewConfigLine err:%s", err)
+	}
+	err = cnf.SetTimeCondition(cnfl)
+	if err != nil {
+		t.Fatalf("SetTimeCondition err:%s", err)
+	}
+	if len(cnf.TimeConditions) != 1 {
+		t.Fatalf("len(cnf.TimeConditions)=%d != 1", len(cnf.TimeConditions))
+	}
+	tc := cnf.TimeConditions[0]
+	expect := `"time" >= now-10m0s`
+	if tc.TimeConditionStr != expect {
+		t.Errorf("mismatch:\n given :%s\n expect:%s", tc.TimeConditionStr, expect)
+	}
+}
@@ -17,9 +17,11 @@
 package expect
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"go/types"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -36,11 +38,19 @@ type Condition struct {
 	ctype  types.BasicKind
 	ccase  int
 	cvalue interface{}
+	cref   string         // pseudo-field which is resolved via Record
+	re     *regexp.Regexp // compiled cvalue of CaseRegex and CaseNotRegex
 }
 type TypeCondition struct {
 	Keys             Keys
 	Condition        Condition
 	TypeConditionStr string
+	Metadata         *Metadata // nil if the rule has no metadata.
+	Matcher          Matcher   // the registered Matcher. nil if Condition is used.
+
+	family string     // the rule family name of Matcher. It is used to create Matcher again from Json.
+	source ConfigLine // the rule which Matcher is created from.
+	param  string     // see ConfigLine.ClParam
 }
 
 const (
@@ -53,6 +63,13 @@ const (
 	CaseNe          //  !=
 	CaseContains    // for string.
 	CaseNotContains // for string.
+	CaseFormat      // for string.
+	CaseNotFormat   // for string.
+	CaseNotZero     // for event time.
+	CaseSubsecond   // for event time.
+	CaseNear        // for event time.
+	CaseRegex       // for string.
+	CaseNotRegex    // for string.
 )
 
 // Str2IntCase converts string case to int case.
@@ -76,6 +93,20 @@ func Str2IntCase(s string) int {
 		ret = CaseContains
 	case "not_contains":
 		ret = CaseNotContains
+	case "format":
+		ret = CaseFormat
+	case "not_format":
+		ret = CaseNotFormat
+	case "not_zero":
+		ret = CaseNotZero
+	case "subsecond":
+		ret = CaseSubsecond
+	case "near":
+		ret = CaseNear
+	case "regex":
+		ret = CaseRegex
+	case "not_regex":
+		ret = CaseNotRegex
 	}
 	return ret
 }
@@ -101,6 +132,20 @@ func IntCase2Str(i int) string {
 		ret = "contains"
 	case CaseNotContains:
 		ret = "not_contains"
+	case CaseFormat:
+		ret = "format"
+	case CaseNotFormat:
+		ret = "not_format"
+	case CaseNotZero:
+		ret = "not_zero"
+	case CaseSubsecond:
+		ret = "subsecond"
+	case CaseNear:
+		ret = "near"
+	case CaseRegex:
+		ret = "regex"
+	case CaseNotRegex:
+		ret = "not_regex"
 	}
 	return ret
 }
@@ -115,6 +160,21 @@ func (c Condition) matchString(s string) bool {
 		return strings.Contains(s, c.cvalue.(string))
 	case CaseNotContains:
 		return !strings.Contains(s, c.cvalue.(string))
+	case CaseFormat:
+		return isFormat(c.cvalue.(string), s)
+	case CaseNotFormat:
+		return !isFormat(c.cvalue.(string), s)
+	case CaseRegex, CaseNotRegex:
+		re := c.re
+		if re == nil {
+			// the value of pseudo-field is compiled each time.
+			var err error
+			re, err = regexp.Compile(c.cvalue.(string))
+			if err != nil {
+				return false
+			}
+		}
+		return re.MatchString(s) == (c.ccase == CaseRegex)
 	}
 	return false
 }
@@ -186,7 +246,10 @@ func (c Condition) matchDouble(d float64) bool {
 // IsMatch check if v matches condition.
 func (c Condition) IsMatch(v interface{}) (bool, error) {
 	if v == nil {
-		return false, errors.New("value is nil")
+		return false, ErrValueIsNil
+	}
+	if c.cref != "" {
+		return false, fmt.Errorf("%w:%s", ErrUnresolved, c.cref)
 	}
 
 	switch c.ctype {
@@ -283,11 +346,14 @@ func (c Condition) IsMatch(v interface{}) (bool, error) {
 			return c.matchDouble(float64(d)), nil
 		}
 	}
-	return false, fmt.Errorf("can not cast: type=%d v=%s\n", c.ctype, v)
+	return false, fmt.Errorf("%w: type=%d v=%v", ErrTypeMismatch, c.ctype, v)
 }
 
 func (c Condition) String() string {
 	ret := IntCase2Str(c.ccase) + " "
+	if c.cref != "" {
+		return ret + c.cref
+	}
 	switch c.ctype {
 	case types.Uint:
 		u, ok := c.cvalue.(uint)
@@ -331,12 +397,20 @@ func NewBoolCondition(c int, b bool) (*Condition, error) {
 }
 
 // NewStringCondition returns Condition c of string.
-//  c must be CaseEq, CaseNe CaseContains or CaseNotContains.
+//  c must be CaseEq, CaseNe CaseContains, CaseNotContains, CaseRegex or CaseNotRegex.
 func NewStringCondition(c int, s string) (*Condition, error) {
-	if c != CaseEq && c != CaseNe && c != CaseContains && c != CaseNotContains {
+	ret := &Condition{ctype: types.String, ccase: c, cvalue: s}
+	switch c {
+	case CaseEq, CaseNe, CaseContains, CaseNotContains:
+	case CaseRegex, CaseNotRegex:
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("regex error:%w", err)
+		}
+		ret.re = re
+	default:
 		return nil, ErrInvalidCondition
 	}
-	ret := &Condition{ctype: types.String, ccase: c, cvalue: s}
 
 	return ret, nil
 }
@@ -375,7 +449,13 @@ func NewDoubleCondition(c int, d float64) (*Condition, error) {
 
 // Compare compares c and ic.
 func (c Condition) Compare(ic Condition) bool {
-	if c.ccase != ic.ccase || c.ctype != ic.ctype || c.cvalue == nil || ic.cvalue == nil {
+	if c.ccase != ic.ccase || c.ctype != ic.ctype || c.cref != ic.cref {
+		return false
+	}
+	if c.cref != "" {
+		return true
+	}
+	if c.cvalue == nil || ic.cvalue == nil {
 		return false
 	}
 	switch c.ctype {
@@ -393,6 +473,92 @@ func (c Condition) Compare(ic Condition) bool {
 	return false
 }
 
+// NewRefCondition returns Condition c of type t.
+//  The value of the condition is pseudo-field ref like "$TAG[1]" and it is resolved by Resolve.
+func NewRefCondition(t types.BasicKind, c int, ref string) (*Condition, error) {
+	if !isPseudo(ref) {
+		return nil, fmt.Errorf("invalid pseudo-field:%s", ref)
+	}
+	var err error
+	switch t {
+	case types.Bool:
+		_, err = NewBoolCondition(c, false)
+	case types.String:
+		_, err = NewStringCondition(c, "")
+	case types.Int:
+		_, err = NewIntCondition(c, 0)
+	case types.Uint:
+		_, err = NewUintCondition(c, 0)
+	case types.Float64:
+		_, err = NewDoubleCondition(c, 0)
+	default:
+		return nil, errors.New("Invalid type")
+	}
+	if err != nil {
+		return nil, err
+	}
+	ret := &Condition{ctype: t, ccase: c, cref: ref}
+
+	return ret, nil
+}
+
+// convertValue converts the value of pseudo-field v to type t.
+func convertValue(t types.BasicKind, v interface{}) (interface{}, error) {
+	s, isStr := v.(string)
+	f, isFloat := v.(float64)
+	switch {
+	case t == types.String && isStr:
+		return s, nil
+	case t == types.String && isFloat:
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case t == types.Bool && isStr:
+		return parsed(strconv.ParseBool(s))
+	case t == types.Int && isStr:
+		return parsed(strconv.Atoi(s))
+	case t == types.Int && isFloat:
+		return int(f), nil
+	case t == types.Uint && isStr:
+		u, err := strconv.ParseUint(s, 10, 0)
+		return parsed(uint(u), err)
+	case t == types.Uint && isFloat:
+		return uint(f), nil
+	case t == types.Float64 && isStr:
+		return parsed(strconv.ParseFloat(s, 64))
+	case t == types.Float64 && isFloat:
+		return f, nil
+	}
+	return nil, fmt.Errorf("%w: type=%d v=%v", ErrTypeMismatch, t, v)
+}
+
+// parsed wraps err of parsing v by ErrParse.
+func parsed(v interface{}, err error) (interface{}, error) {
+	if err != nil {
+		return nil, fmt.Errorf("%w:%s", ErrParse, err)
+	}
+	return v, nil
+}
+
+// Resolve returns Condition whose pseudo-field value is resolved via r.
+//  If c has no pseudo-field, it returns c.
+func (c Condition) Resolve(r *Record) (Condition, error) {
+	if c.cref == "" {
+		return c, nil
+	}
+	v, ok := r.pseudoValue(c.cref)
+	if !ok {
+		return c, fmt.Errorf("%s %w", c.cref, ErrKeyNotFound)
+	}
+	cv, err := convertValue(c.ctype, v)
+	if err != nil {
+		return c, fmt.Errorf("%s convert error:%w", c.cref, err)
+	}
+	ret := c
+	ret.cvalue = cv
+	ret.cref = ""
+
+	return ret, nil
+}
+
 func (cnf *Config) SetTypeCondition(c *ConfigLine, t types.BasicKind) error {
 	if c == nil {
 		return errors.New("ConfigLine is nil")
@@ -401,37 +567,71 @@ func (cnf *Config) SetTypeCondition(c *ConfigLine, t types.BasicKind) error {
 	if err != nil {
 		return fmt.Errorf("SetExists:%w", err)
 	}
-	tc := &TypeCondition{Keys: *k}
+	tc := &TypeCondition{Keys: *k, Metadata: c.metadata(), param: c.ClParam}
 	cnd := &Condition{}
+	if s, ok := c.ClValue.(string); ok && looksPseudo(s) {
+		cnd, err = NewRefCondition(t, Str2IntCase(c.ClCondition), s)
+		if err != nil {
+			return fmt.Errorf("NewRefCondition err:%w", err)
+		}
+		tc.Condition = *cnd
+		tc.TypeConditionStr = tc.String()
+		cnf.TypeConditions = append(cnf.TypeConditions, *tc)
+		return nil
+	}
 	switch t {
 	case types.Uint:
-		jn, ok := c.ClValue.(float64)
-		if !ok {
+		var i uint
+		switch jn := c.ClValue.(type) {
+		case float64:
+			i = uint(jn)
+		case json.Number:
+			u, err := strconv.ParseUint(jn.String(), 10, 0)
+			if err != nil {
+				return fmt.Errorf("json number convert error:%w", err)
+			}
+			i = uint(u)
+		default:
 			return fmt.Errorf("json number convert error. type=%T", c.ClValue)
 		}
-		i := uint(jn)
 		cnd, err = NewUintCondition(Str2IntCase(c.ClCondition), i)
 		if err != nil {
 			return fmt.Errorf("NewUintCondition err:%s", err)
 		}
 
 	case types.Int:
-		jn, ok := c.ClValue.(float64)
-		if !ok {
+		var i int
+		switch jn := c.ClValue.(type) {
+		case float64:
+			i = int(jn)
+		case json.Number:
+			n, err := strconv.ParseInt(jn.String(), 10, 0)
+			if err != nil {
+				return fmt.Errorf("json number convert error:%w", err)
+			}
+			i = int(n)
+		default:
 			return errors.New("json number convert error")
 		}
-		i := int(jn)
 		cnd, err = NewIntCondition(Str2IntCase(c.ClCondition), i)
 		if err != nil {
 			return fmt.Errorf("NewIntCondition err:%s", err)
 		}
 
 	case types.Float64:
-		jn, ok := c.ClValue.(float64)
-		if !ok {
+		var f float64
+		switch jn := c.ClValue.(type) {
+		case float64:
+			f = jn
+		case json.Number:
+			f, err = jn.Float64()
+			if err != nil {
+				return fmt.Errorf("json number convert error:%w", err)
+			}
+		default:
 			return errors.New("json number convert error")
 		}
-		cnd, err = NewDoubleCondition(Str2IntCase(c.ClCondition), jn)
+		cnd, err = NewDoubleCondition(Str2IntCase(c.ClCondition), f)
 		if err != nil {
 			return fmt.Errorf("NewDoubleCondition err:%s", err)
 		}
@@ -440,7 +640,7 @@ func (cnf *Config) SetTypeCondition(c *ConfigLine, t types.BasicKind) error {
 		if !ok {
 			return errors.New("json string convert error")
 		}
-		cnd, err = NewStringCondition(Str2IntCase(c.ClCondition), s)
+		cnd, err = NewStringCondition(Str2IntCase(c.ClCondition), unescapePseudo(s))
 		if err != nil {
 			return fmt.Errorf("NewStringCondition err:%s", err)
 		}
@@ -464,6 +664,9 @@ func (cnf *Config) SetTypeCondition(c *ConfigLine, t types.BasicKind) error {
 }
 
 func (tc TypeCondition) String() string {
+	if tc.Matcher != nil {
+		return fmt.Sprintf("%s %s", tc.Keys.String(), tc.Matcher.String())
+	}
 	return fmt.Sprintf("%s %s", tc.Keys.String(), tc.Condition.String())
 
 }
@@ -35,6 +35,8 @@ func TestStr2IntCase(t *testing.T) {
 		{"le", "<=", CaseLe},
 		{"eq", "==", CaseEq},
 		{"ne", "!=", CaseNe},
+		{"regex", "regex", CaseRegex},
+		{"not regex", "not_regex", CaseNotRegex},
 		{"invalid", "<=>", CaseInvalid},
 	}
 
@@ -93,6 +95,8 @@ func TestNewStringCondition(t *testing.T) {
 		{"ne", CaseNe, "hoge"},
 		{"cont", CaseContains, "hoge"},
 		{"not cont", CaseNotContains, "hoge"},
+		{"regex", CaseRegex, "^ho+ge$"},
+		{"not regex", CaseNotRegex, "^ho+ge$"},
 	}
 
 	for i, v := range okCases {
@@ -106,6 +110,7 @@ func TestNewStringCondition(t *testing.T) {
 		{"gt", CaseGt, "hoge"},
 		{"le", CaseLe, "hoge"},
 		{"lt", CaseLt, "hoge"},
+		{"invalid regex", CaseRegex, "(hoge"},
 	}
 	for i, v := range ngCases {
 		_, err := NewStringCondition(v.inputCase, v.inputVal)
@@ -128,6 +133,23 @@ func testMatch(t *testing.T, c *Condition, v interface{}, e bool) {
 
 }
 
+func TestMatchRegex(t *testing.T) {
+	c, err := NewStringCondition(CaseRegex, ".+@.+")
+	if err != nil {
+		t.Fatalf("NewStringCondition err:%s", err)
+	}
+	testMatch(t, c, "user@example.com", true)
+	testMatch(t, c, []byte("user@example.com"), true)
+	testMatch(t, c, "user", false)
+
+	c, err = NewStringCondition(CaseNotRegex, "^debug")
+	if err != nil {
+		t.Fatalf("NewStringCondition err:%s", err)
+	}
+	testMatch(t, c, "debug log", false)
+	testMatch(t, c, "info log", true)
+}
+
 func TestMatchBool(t *testing.T) {
 	// true case
 	c, err := NewBoolCondition(CaseEq, true)
@@ -0,0 +1,277 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package gexpecttest runs the plugin in process without Fluent Bit.
+//  Plugin fakes the configuration of [OUTPUT] and the context storage of Fluent Bit.
+//  It drives Init, FlushCtx and Exit of the plugin like FLBPluginInit, FLBPluginFlushCtx and FLBPluginExit,
+//  and captures reports of failed rules.
+package gexpecttest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/nokute78/fluentbit-plugin-out-expect/expect"
+	"github.com/nokute78/fluentbit-plugin-out-expect/gexpect"
+	"github.com/ugorji/go/codec"
+)
+
+// Record is a record of a chunk.
+type Record struct {
+	Time time.Time
+	Map  map[string]interface{}
+}
+
+// Report is reports of a record. See gexpect.Host.
+type Report struct {
+	Tag      string
+	Failures []expect.Failure
+}
+
+// Plugin is an instance of the plugin with a fake gexpect.Host.
+type Plugin struct {
+	Config map[string]string // configuration of [OUTPUT] like "key_int0". Keys are case insensitive.
+
+	instance *byte // the address is the plugin pointer and the context pointer.
+
+	mu       sync.Mutex
+	ctx      interface{}
+	reports  []Report
+	exitCode int
+	exited   chan struct{} // closed at the first Exit of Host.
+}
+
+// New returns Plugin which has config.
+func New(config map[string]string) *Plugin {
+	return &Plugin{Config: config, instance: new(byte), exited: make(chan struct{})}
+}
+
+func (p *Plugin) pointer() unsafe.Pointer {
+	return unsafe.Pointer(p.instance)
+}
+
+// Init calls gexpect.Init like FLBPluginInit.
+func (p *Plugin) Init() int {
+	return gexpect.Init(host{p}, p.pointer())
+}
+
+// Flush calls gexpect.FlushCtx like FLBPluginFlushCtx with msgpack chunk.
+func (p *Plugin) Flush(tag string, chunk []byte) int {
+	var data unsafe.Pointer
+	if len(chunk) > 0 {
+		data = unsafe.Pointer(&chunk[0])
+	}
+	return gexpect.FlushCtx(host{p}, p.pointer(), data, len(chunk), tag)
+}
+
+// FlushRecords flushes the chunk of records. See Chunk.
+func (p *Plugin) FlushRecords(tag string, records ...Record) (int, error) {
+	chunk, err := Chunk(records...)
+	if err != nil {
+		return 0, err
+	}
+	return p.Flush(tag, chunk), nil
+}
+
+// FlushJson flushes the chunk of Json records. The timestamp of records is now. See ChunkFromJson.
+func (p *Plugin) FlushJson(tag string, s string) (int, error) {
+	chunk, err := ChunkFromJson(time.Now(), s)
+	if err != nil {
+		return 0, err
+	}
+	return p.Flush(tag, chunk), nil
+}
+
+// Exit calls gexpect.ExitCtx. Only the instance p is stopped.
+func (p *Plugin) Exit() int {
+	return gexpect.ExitCtx(host{p}, p.pointer())
+}
+
+// Reports returns captured reports.
+func (p *Plugin) Reports() []Report {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Report{}, p.reports...)
+}
+
+// Failures returns failures of all captured reports.
+func (p *Plugin) Failures() []expect.Failure {
+	ret := []expect.Failure{}
+	for _, r := range p.Reports() {
+		ret = append(ret, r.Failures...)
+	}
+	return ret
+}
+
+// Exited returns the exit code if the plugin exited the process.
+//  The process is not exited actually.
+func (p *Plugin) Exited() (int, bool) {
+	select {
+	case <-p.exited:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.exitCode, true
+	default:
+	}
+	return 0, false
+}
+
+// WaitExit waits the plugin to exit the process for d. e.g. test_timeout
+func (p *Plugin) WaitExit(d time.Duration) (int, bool) {
+	select {
+	case <-p.exited:
+	case <-time.After(d):
+	}
+	return p.Exited()
+}
+
+// host is the fake gexpect.Host of Plugin.
+type host struct {
+	p *Plugin
+}
+
+func (h host) ConfigKey(plugin unsafe.Pointer, key string) string {
+	if plugin != h.p.pointer() {
+		return ""
+	}
+	for k, v := range h.p.Config {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+func (h host) SetContext(plugin unsafe.Pointer, ctx interface{}) {
+	if plugin != h.p.pointer() {
+		return
+	}
+	h.p.mu.Lock()
+	defer h.p.mu.Unlock()
+	h.p.ctx = ctx
+}
+
+func (h host) GetContext(ctx unsafe.Pointer) interface{} {
+	if ctx != h.p.pointer() {
+		return nil
+	}
+	h.p.mu.Lock()
+	defer h.p.mu.Unlock()
+	return h.p.ctx
+}
+
+func (h host) Report(tag string, reports []expect.Failure) {
+	h.p.mu.Lock()
+	defer h.p.mu.Unlock()
+	h.p.reports = append(h.p.reports, Report{Tag: tag, Failures: reports})
+}
+
+// Exit records only the first code since the process exits at that time.
+func (h host) Exit(code int) {
+	h.p.mu.Lock()
+	defer h.p.mu.Unlock()
+	select {
+	case <-h.p.exited:
+		return
+	default:
+	}
+	h.p.exitCode = code
+	close(h.p.exited)
+}
+
+// Chunk returns msgpack chunk of records like Fluent Bit.
+//  Each record is an array of the event time and the map.
+func Chunk(records ...Record) ([]byte, error) {
+	var b bytes.Buffer
+	h := &codec.MsgpackHandle{WriteExt: true}
+	for i, r := range records {
+		m := r.Map
+		if m == nil {
+			m = map[string]interface{}{}
+		}
+		var mb []byte
+		if err := codec.NewEncoderBytes(&mb, h).Encode(m); err != nil {
+			return nil, fmt.Errorf("records[%d]:%w", i, err)
+		}
+		// fixarray of 2 elements and fixext8 of type 0 (EventTime)
+		b.Write([]byte{0x92, 0xd7, 0x00})
+		binary.Write(&b, binary.BigEndian, uint32(r.Time.Unix()))
+		binary.Write(&b, binary.BigEndian, uint32(r.Time.Nanosecond()))
+		b.Write(mb)
+	}
+	return b.Bytes(), nil
+}
+
+// ChunkFromJson returns msgpack chunk of Json records which have the timestamp ts.
+//  s is an array of Json objects or a Json object.
+//  Integers are int64 and other numbers are float64.
+func ChunkFromJson(ts time.Time, s string) ([]byte, error) {
+	records, err := RecordsFromJson(ts, s)
+	if err != nil {
+		return nil, err
+	}
+	return Chunk(records...)
+}
+
+// RecordsFromJson returns records of Json s which have the timestamp ts. See ChunkFromJson.
+func RecordsFromJson(ts time.Time, s string) ([]Record, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "[") {
+		s = "[" + s + "]"
+	}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var ms []map[string]interface{}
+	if err := dec.Decode(&ms); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("invalid data after top-level value")
+	}
+	ret := make([]Record, len(ms))
+	for i, m := range ms {
+		ret[i] = Record{Time: ts, Map: convertNumbers(m).(map[string]interface{})}
+	}
+	return ret, nil
+}
+
+// convertNumbers converts json.Number of v to int64 or float64.
+func convertNumbers(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case json.Number:
+		if i, err := vv.Int64(); err == nil {
+			return i
+		}
+		f, _ := vv.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range vv {
+			vv[k] = convertNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range vv {
+			vv[i] = convertNumbers(e)
+		}
+	}
+	return v
+}
@@ -0,0 +1,97 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package gexpecttest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/fluent/fluent-bit-go/output"
+)
+
+func TestChunk(t *testing.T) {
+	ts := time.Date(2021, 4, 1, 12, 0, 0, 123456789, time.UTC)
+	chunk, err := Chunk(
+		Record{Time: ts, Map: map[string]interface{}{"log": "a", "n": int64(-1), "m": map[string]interface{}{"b": true}}},
+		Record{Time: ts},
+	)
+	if err != nil {
+		t.Fatalf("Chunk err:%s", err)
+	}
+
+	dec := output.NewDecoder(unsafe.Pointer(&chunk[0]), len(chunk))
+	expect := []map[interface{}]interface{}{
+		{"log": []byte("a"), "n": int64(-1), "m": map[interface{}]interface{}{"b": true}},
+		{},
+	}
+	for i, e := range expect {
+		ret, ts2, record := output.GetRecord(dec)
+		if ret != 0 {
+			t.Fatalf("%d: GetRecord error ret=%d", i, ret)
+		}
+		ft, ok := ts2.(output.FLBTime)
+		if !ok || !ft.Time.Equal(ts) {
+			t.Errorf("%d: time mismatch given=%v expect=%v", i, ts2, ts)
+		}
+		if !reflect.DeepEqual(record, e) {
+			t.Errorf("%d mismatch:\n given :%#v\n expect:%#v", i, record, e)
+		}
+	}
+	if ret, _, _ := output.GetRecord(dec); ret == 0 {
+		t.Errorf("expect end of chunk")
+	}
+}
+
+func TestRecordsFromJson(t *testing.T) {
+	type testcase struct {
+		name   string
+		value  string
+		expect []map[string]interface{}
+	}
+	ts := time.Unix(1617278400, 0)
+
+	cases := []testcase{
+		{"object", `{"a":1}`, []map[string]interface{}{{"a": int64(1)}}},
+		{"array", `[{"a":1.5}, {"b":[2, "c"]}]`, []map[string]interface{}{{"a": 1.5}, {"b": []interface{}{int64(2), "c"}}}},
+		{"nested", `{"a":{"b":-3, "c":null}}`, []map[string]interface{}{{"a": map[string]interface{}{"b": int64(-3), "c": nil}}}},
+	}
+
+	for _, v := range cases {
+		ret, err := RecordsFromJson(ts, v.value)
+		if err != nil {
+			t.Errorf("%s: RecordsFromJson err:%s", v.name, err)
+			continue
+		}
+		if len(ret) != len(v.expect) {
+			t.Errorf("%s: length mismatch:%+v", v.name, ret)
+			continue
+		}
+		for i, r := range ret {
+			if !r.Time.Equal(ts) || !reflect.DeepEqual(r.Map, v.expect[i]) {
+				t.Errorf("%s mismatch:\n given :%#v\n expect:%#v", v.name, r.Map, v.expect[i])
+			}
+		}
+	}
+
+	for _, s := range []string{`1`, `[{"a":1}`, `{"a":1} {"b":2}`} {
+		if _, err := RecordsFromJson(ts, s); err == nil {
+			t.Errorf("%s: expect error", s)
+		}
+	}
+}
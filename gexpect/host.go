@@ -0,0 +1,60 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package gexpect
+
+import (
+	"os"
+	"unsafe"
+
+	"github.com/fluent/fluent-bit-go/output"
+	"github.com/nokute78/fluentbit-plugin-out-expect/expect"
+)
+
+// Host is the API of Fluent Bit which the plugin uses.
+//  FluentBit is the real one. Tests can use a fake one. See package gexpecttest.
+type Host interface {
+	ConfigKey(plugin unsafe.Pointer, key string) string // the value of the configuration key. blank if it is not set.
+	SetContext(plugin unsafe.Pointer, ctx interface{})
+	GetContext(ctx unsafe.Pointer) interface{}
+	Report(tag string, reports []expect.Failure) // reports of a record.
+	Exit(code int)                               // exits the process for ActionExit and test mode.
+}
+
+// FluentBit is Host of Fluent Bit via the output package of fluent-bit-go.
+var FluentBit Host = fluentBit{}
+
+type fluentBit struct{}
+
+func (fluentBit) ConfigKey(plugin unsafe.Pointer, key string) string {
+	return output.FLBPluginConfigKey(plugin, key)
+}
+
+func (fluentBit) SetContext(plugin unsafe.Pointer, ctx interface{}) {
+	output.FLBPluginSetContext(plugin, ctx)
+}
+
+func (fluentBit) GetContext(ctx unsafe.Pointer) interface{} {
+	return output.FLBPluginGetContext(ctx)
+}
+
+func (fluentBit) Report(tag string, reports []expect.Failure) {
+	reportsErrors(reports, tag)
+}
+
+func (fluentBit) Exit(code int) {
+	os.Exit(code)
+}
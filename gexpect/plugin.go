@@ -0,0 +1,585 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package gexpect is the output plugin "gexpect" of Fluent Bit.
+//  The entry points of Fluent Bit call Init, FlushCtx and Exit via Host.
+package gexpect
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/fluent/fluent-bit-go/output"
+	"github.com/nokute78/fluentbit-plugin-out-expect/expect"
+)
+
+const Version = "0.0.1"
+
+// parseBool parses s like "on", "off", "true" or "false".
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "on", "true", "yes":
+		return true, nil
+	case "off", "false", "no":
+		return false, nil
+	}
+	return false, errors.New("Invalid bool:" + s)
+}
+
+// configRule represents a rule of the configuration.
+type configRule struct {
+	key  string // configuration name like "key_int0" or "rules[1]"
+	name string // rule name like "key_int". blank means "type" of line.
+	line *expect.ConfigLine
+	err  error // error of decoding. line is nil if it is not nil.
+}
+
+// configSource holds the configuration which is read at FLBPluginInit.
+//  Config is rebuilt from it when rules_path is reloaded.
+type configSource struct {
+	rules              []configRule
+	template           *expect.Template
+	definitions        *expect.RuleDocument // aliases and templates of rules_file
+	reportUnclassified bool
+	strict             bool
+}
+
+// addParam adds the rule of param.
+//  The value of "rules" is an array of rules which have "type" and the value of "expect" is rules of text.
+func (s *configSource) addParam(key string, name string, value string) {
+	if name == expect.ConfigExpectKeyName {
+		lines, err := expect.ParseRules(value)
+		if err != nil {
+			s.rules = append(s.rules, configRule{key: key, err: err})
+			return
+		}
+		s.addLines(key, lines)
+		return
+	}
+	if name != expect.ConfigRulesKeyName {
+		newConfigLine := expect.NewConfigLineFromJson
+		if s.strict {
+			newConfigLine = expect.NewConfigLineFromJsonStrict
+		}
+		line, err := newConfigLine(value)
+		s.rules = append(s.rules, configRule{key: key, name: name, line: line, err: err})
+		return
+	}
+
+	newConfigLines := expect.NewConfigLinesFromJson
+	if s.strict {
+		newConfigLines = expect.NewConfigLinesFromJsonStrict
+	}
+	lines, err := newConfigLines(value)
+	if err != nil {
+		s.rules = append(s.rules, configRule{key: key, err: err})
+		return
+	}
+	s.addLines(key, lines)
+}
+
+// addLines adds lines which have "type".
+func (s *configSource) addLines(key string, lines []expect.ConfigLine) {
+	for i := range lines {
+		s.rules = append(s.rules, configRule{key: fmt.Sprintf("%s[%d]", key, i), line: &lines[i]})
+	}
+}
+
+// expandTemplates expands "${ENV}" and "@file:path" of values of rules.
+func (s *configSource) expandTemplates(report func(string, error)) {
+	if s.definitions != nil {
+		if err := s.template.ExpandDefinitions(s.definitions); err != nil {
+			report(expect.ConfigRulesFileKeyName, err)
+			s.definitions = nil
+		}
+	}
+	for i, rule := range s.rules {
+		if rule.err != nil {
+			continue
+		}
+		name := rule.name
+		if name == "" {
+			var err error
+			name, err = rule.line.RuleName()
+			if err != nil {
+				// newConfig reports it.
+				continue
+			}
+		}
+		s.rules[i].err = s.template.ExpandConfigLine(name, rule.line)
+	}
+}
+
+// newConfig returns Config via s.
+//  Errors of rules are passed to report with the configuration name.
+func (s *configSource) newConfig(report func(string, error)) expect.Config {
+	cnf := expect.Config{ReportUnclassified: s.reportUnclassified, Definitions: expect.NewDefinitions()}
+	reported := make(map[string]bool)
+	if s.definitions != nil {
+		if err := cnf.Definitions.Add(s.definitions); err != nil {
+			report(expect.ConfigRulesFileKeyName, err)
+		}
+	}
+
+	order := make(map[string]int)
+	for i, rule := range s.rules {
+		if rule.err != nil {
+			report(rule.key, rule.err)
+			continue
+		}
+		order[rule.key] = i
+		rule.line.ClParam = rule.key
+		name := rule.name
+		if name == "" {
+			var err error
+			name, err = rule.line.RuleName()
+			if err != nil {
+				report(rule.key, err)
+				continue
+			}
+		}
+		err := cnf.SetConfigLine(name, rule.line)
+		if err != nil {
+			report(rule.key, err)
+			continue
+		}
+	}
+
+	// errors of analysis are reported with the last parameter which causes them.
+	// duplicated rules are also errors in strict mode.
+	for _, f := range cnf.Analyze() {
+		if !(f.Severity == expect.SeverityError || s.strict && f.Duplicate) || reported[f.String()] {
+			continue
+		}
+		reported[f.String()] = true
+		key, last := expect.ConfigRulesKeyName, -1
+		for _, param := range f.Params {
+			if i, ok := order[param]; ok && i > last {
+				key, last = param, i
+			}
+		}
+		report(key, errors.New(f.String()))
+	}
+	return cnf
+}
+
+// undefinedRuleSetsError returns an error if cnf uses undefined rule sets.
+func undefinedRuleSetsError(cnf *expect.Config) error {
+	if names := cnf.UndefinedRuleSets(); len(names) > 0 {
+		return errors.New("undefined rule set:" + strings.Join(names, ","))
+	}
+	return nil
+}
+
+// buildConfig returns a validated Config via s and the rules document of rules_path.
+//  Only errors of the rules of d reject d. Errors of other rules are reported at Init.
+func (s *configSource) buildConfig(d *expect.RuleDocument) (*expect.Config, error) {
+	err := s.template.ExpandRuleDocument(d)
+	if err != nil {
+		return nil, err
+	}
+	for i := range d.Rules {
+		d.Rules[i].ClParam = fmt.Sprintf("%s[%d]", expect.ConfigRulesPathKeyName, i)
+	}
+	cnf := s.newConfig(func(string, error) {})
+	err = cnf.ApplyRuleDocument(d)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range cnf.Analyze() {
+		if !(f.Severity == expect.SeverityError || s.strict && f.Duplicate) {
+			continue
+		}
+		for _, param := range f.Params {
+			if strings.HasPrefix(param, expect.ConfigRulesPathKeyName+"[") {
+				return nil, fmt.Errorf("%s:%s", param, f)
+			}
+		}
+	}
+	err = undefinedRuleSetsError(&cnf)
+	if err != nil {
+		return nil, err
+	}
+	return &cnf, nil
+}
+
+// logFindings logs warnings and infos of the analysis of cnf with the parameters of the rules.
+//  Errors are reported when cnf is built.
+func logFindings(cnf *expect.Config) {
+	for _, f := range cnf.Analyze() {
+		if f.Severity == expect.SeverityError {
+			continue
+		}
+		params := []string{}
+		for _, param := range f.Params {
+			if param != "" {
+				params = append(params, param)
+			}
+		}
+		if len(params) == 0 {
+			log.Printf("[expect] %s\n", f)
+		} else {
+			log.Printf("[expect] %s %s\n", strings.Join(params, ","), f)
+		}
+	}
+}
+
+// pluginContext represents context of each plugin instance.
+type pluginContext struct {
+	host     Host
+	cnf      expect.Config
+	reloader *expect.Reloader // nil if rules_path is not set.
+	stop     chan struct{}    // nil if rules_path is not set.
+	timer    *time.Timer      // timer of test_timeout. nil if it is not set.
+	actions  expect.Actions   // action of the severity of failed rules.
+	exitCode int              // for ActionExit and the failed test
+	test     *expect.TestRun  // nil if test mode is off.
+}
+
+// finishTest logs the summary of the test and exits the process.
+//  The exit code is 0 if the test passed. Otherwise it is exitCode.
+func (ctx *pluginContext) finishTest(reason string) {
+	if !ctx.test.Finish() {
+		return
+	}
+	log.Printf("[expect] test finished by %s: %s\n", reason, ctx.test.Summary())
+	if ctx.test.Passed() {
+		ctx.host.Exit(0)
+		return
+	}
+	ctx.host.Exit(ctx.exitCode)
+}
+
+// config returns Config to check records.
+//  If rules_path is set, it returns the latest loaded Config.
+func (ctx *pluginContext) config() *expect.Config {
+	if ctx.reloader != nil {
+		return ctx.reloader.Config()
+	}
+	return &ctx.cnf
+}
+
+// running is the list of contexts which watch rules_path or wait test_timeout.
+//  They are stopped at ExitCtx or FLBPluginExit.
+var running struct {
+	sync.Mutex
+	ctxs []*pluginContext
+}
+
+// close stops watching rules_path and the timer of test_timeout.
+func (ctx *pluginContext) close() {
+	if ctx.stop != nil {
+		close(ctx.stop)
+	}
+	if ctx.timer != nil {
+		ctx.timer.Stop()
+	}
+}
+
+// watch reloads rules_path on file change until ctx.stop is closed.
+//  If sighup is true, it also reloads on SIGHUP. It replaces SIGHUP handling of Fluent Bit.
+func (ctx *pluginContext) watch(interval time.Duration, sighup bool) {
+	var sig chan os.Signal
+	if sighup {
+		sig = make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGHUP)
+		defer signal.Stop(sig)
+	}
+
+	ctx.reloader.Watch(interval, sig, ctx.stop, func(err error) {
+		if err != nil {
+			log.Printf("[expect] %s reload error=%s. keep current rules\n", expect.ConfigRulesPathKeyName, err)
+		} else {
+			log.Printf("[expect] %s reloaded\n", expect.ConfigRulesPathKeyName)
+			logFindings(ctx.config())
+		}
+	})
+}
+
+// Init initializes the plugin instance p via h. FLBPluginInit calls it.
+//  It returns output.FLB_OK or output.FLB_ERROR.
+func Init(h Host, p unsafe.Pointer) int {
+	src := &configSource{template: expect.NewTemplate()}
+	log.Printf("[expect] Ver: %s\n", Version)
+
+	failed := false
+	report := func(key string, err error) {
+		log.Printf("%s config error=%s\n", key, err)
+		failed = true
+	}
+
+	if param := h.ConfigKey(p, expect.ConfigStrictKeyName); param != "" {
+		b, err := parseBool(param)
+		if err != nil {
+			report(expect.ConfigStrictKeyName, err)
+		}
+		src.strict = b
+	}
+
+	maxIndex := expect.DefaultMaxIndex
+	if param := h.ConfigKey(p, expect.ConfigMaxIndexKeyName); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 0 {
+			report(expect.ConfigMaxIndexKeyName, errors.New("invalid index:"+param))
+		} else {
+			maxIndex = n
+		}
+	}
+
+	lookup := func(key string) string {
+		return h.ConfigKey(p, key)
+	}
+	for _, name := range []string{expect.ConfigRulesKeyName, expect.ConfigExpectKeyName} {
+		if param := h.ConfigKey(p, name); param != "" {
+			src.addParam(name, name, param)
+		}
+	}
+	names := append(expect.RuleNames(), expect.ConfigRulesKeyName, expect.ConfigExpectKeyName)
+	params, warns := expect.LookupParams(lookup, names, maxIndex)
+	for _, w := range warns {
+		if src.strict && w.Duplicate != nil {
+			report(w.Param.Key(), errors.New(w.String()))
+		} else {
+			log.Printf("[expect] warning: %s\n", w)
+		}
+	}
+	for _, param := range params {
+		src.addParam(param.Key(), param.Name, param.Value)
+	}
+
+	if path := h.ConfigKey(p, expect.ConfigRulesFileKeyName); path != "" {
+		doc, err := expect.LoadRuleDocument(path)
+		if err != nil {
+			report(expect.ConfigRulesFileKeyName, err)
+		} else {
+			src.addLines(expect.ConfigRulesFileKeyName, doc.Rules)
+			src.definitions = doc
+		}
+	}
+
+	if param := h.ConfigKey(p, expect.ConfigReportUnclassifiedKeyName); param != "" {
+		b, err := parseBool(param)
+		if err != nil {
+			report(expect.ConfigReportUnclassifiedKeyName, err)
+		}
+		src.reportUnclassified = b
+	}
+
+	src.expandTemplates(report)
+	ctx := &pluginContext{host: h, cnf: src.newConfig(report), actions: expect.Actions{}, exitCode: expect.DefaultExitCode}
+
+	for sev, key := range expect.ConfigActionKeyNames {
+		if param := h.ConfigKey(p, key); param != "" {
+			a, err := expect.ParseAction(param)
+			if err != nil {
+				report(key, err)
+			}
+			ctx.actions[sev] = a
+		}
+	}
+	testRecords := 0
+	if param := h.ConfigKey(p, expect.ConfigTestRecordsKeyName); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n <= 0 {
+			report(expect.ConfigTestRecordsKeyName, errors.New("invalid number:"+param))
+		} else {
+			testRecords = n
+		}
+	}
+	var testTimeout time.Duration
+	if param := h.ConfigKey(p, expect.ConfigTestTimeoutKeyName); param != "" {
+		d, err := time.ParseDuration(param)
+		if err != nil || d <= 0 {
+			report(expect.ConfigTestTimeoutKeyName, errors.New("invalid duration:"+param))
+		} else {
+			testTimeout = d
+		}
+	}
+	if testRecords > 0 || testTimeout > 0 {
+		ctx.test = expect.NewTestRun(testRecords)
+	}
+	if param := h.ConfigKey(p, expect.ConfigExitCodeKeyName); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 || n > 255 {
+			report(expect.ConfigExitCodeKeyName, errors.New("invalid exit code:"+param))
+		} else {
+			ctx.exitCode = n
+		}
+	}
+
+	interval := expect.DefaultReloadInterval
+	sighup := false
+	if path := h.ConfigKey(p, expect.ConfigRulesPathKeyName); path != "" {
+		if param := h.ConfigKey(p, expect.ConfigReloadOnSighupKeyName); param != "" {
+			b, err := parseBool(param)
+			if err != nil {
+				report(expect.ConfigReloadOnSighupKeyName, err)
+			}
+			sighup = b
+		}
+		if param := h.ConfigKey(p, expect.ConfigReloadIntervalKeyName); param != "" {
+			d, err := time.ParseDuration(param)
+			if err != nil {
+				report(expect.ConfigReloadIntervalKeyName, err)
+			} else {
+				interval = d
+			}
+		}
+		rl, err := expect.NewReloader(path, src.buildConfig)
+		if err != nil {
+			log.Printf("%s config error=%s\n", expect.ConfigRulesPathKeyName, err)
+			return output.FLB_ERROR
+		}
+		ctx.reloader = rl
+	} else if err := undefinedRuleSetsError(&ctx.cnf); err != nil {
+		// rules_path may define them.
+		report(expect.ConfigRuleSetKeyName, err)
+	}
+
+	logFindings(ctx.config())
+
+	if src.strict && failed {
+		log.Printf("[expect] %s: initialization failed due to configuration errors\n", expect.ConfigStrictKeyName)
+		return output.FLB_ERROR
+	}
+
+	if ctx.reloader != nil {
+		ctx.stop = make(chan struct{})
+		go ctx.watch(interval, sighup)
+	}
+
+	if ctx.test != nil && testTimeout > 0 {
+		ctx.timer = time.AfterFunc(testTimeout, func() { ctx.finishTest(expect.ConfigTestTimeoutKeyName) })
+	}
+
+	if ctx.stop != nil || ctx.timer != nil {
+		running.Lock()
+		running.ctxs = append(running.ctxs, ctx)
+		running.Unlock()
+	}
+
+	h.SetContext(p, ctx)
+	return output.FLB_OK
+}
+
+// reportsErrors logs reports of the record which has tag.
+func reportsErrors(reports []expect.Failure, tag string) {
+	log.Println(strconv.Itoa(len(reports)) + " error(s) detected! tag:" + tag)
+	for _, v := range reports {
+		log.Println(" " + v.Error())
+	}
+	log.Println("")
+}
+
+// FlushCtx checks records of the chunk data which has tag. FLBPluginFlushCtx calls it.
+//  ctx is the context pointer of the instance which Init sets via h.
+//  It returns output.FLB_OK, output.FLB_ERROR or output.FLB_RETRY by actions of failed rules.
+func FlushCtx(h Host, ctx unsafe.Pointer, data unsafe.Pointer, length int, tag string) int {
+	pctx, ok := h.GetContext(ctx).(*pluginContext)
+	if !ok {
+		log.Println("[expect] Context Conversion error")
+		return output.FLB_ERROR
+	}
+
+	// Records of this flush are checked by the same Config even if rules are reloaded.
+	ev := expect.NewEvaluator(pctx.config())
+
+	dec := output.NewDecoder(data, length)
+	action := expect.ActionLog
+
+	for index := 0; ; index++ {
+		ret, ts, record := output.GetRecord(dec)
+		if ret != 0 {
+			break
+		}
+		if t, ok := ts.(output.FLBTime); ok {
+			ts = t.Time
+		}
+		r := &expect.Record{Tag: tag, Time: expect.NewEventTime(ts), Map: record}
+
+		reports := ev.EvaluateRecord(r)
+		for i := range reports {
+			reports[i].RecordIndex = index
+		}
+		if len(reports) > 0 {
+			h.Report(tag, reports)
+		}
+		sevs := make([]expect.Severity, len(reports))
+		for i, v := range reports {
+			sevs[i] = v.Severity
+		}
+		if a := pctx.actions.Of(sevs...); a > action {
+			action = a
+		}
+		if pctx.test != nil && pctx.test.Add(sevs...) {
+			pctx.finishTest(expect.ConfigTestRecordsKeyName)
+		}
+	}
+
+	switch action {
+	case expect.ActionExit:
+		if pctx.test != nil {
+			pctx.finishTest(expect.ActionExit.String())
+		}
+		log.Printf("[expect] exit code=%d tag:%s\n", pctx.exitCode, tag)
+		h.Exit(pctx.exitCode)
+		return output.FLB_ERROR
+	case expect.ActionError:
+		return output.FLB_ERROR
+	case expect.ActionRetry:
+		return output.FLB_RETRY
+	}
+	return output.FLB_OK
+}
+
+// ExitCtx stops the plugin instance of ctx. Other instances keep running.
+func ExitCtx(h Host, ctx unsafe.Pointer) int {
+	pctx, ok := h.GetContext(ctx).(*pluginContext)
+	if !ok {
+		log.Println("[expect] Context Conversion error")
+		return output.FLB_ERROR
+	}
+	running.Lock()
+	defer running.Unlock()
+	for i, c := range running.ctxs {
+		if c == pctx {
+			running.ctxs = append(running.ctxs[:i], running.ctxs[i+1:]...)
+			c.close()
+			break
+		}
+	}
+	return output.FLB_OK
+}
+
+// Exit stops all plugin instances. FLBPluginExit calls it.
+func Exit() int {
+	running.Lock()
+	for _, ctx := range running.ctxs {
+		ctx.close()
+	}
+	running.ctxs = nil
+	running.Unlock()
+	return output.FLB_OK
+}
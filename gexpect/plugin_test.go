@@ -0,0 +1,336 @@
+/*
+   Copyright 2021 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package gexpect_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fluent/fluent-bit-go/output"
+	"github.com/nokute78/fluentbit-plugin-out-expect/expect"
+	"github.com/nokute78/fluentbit-plugin-out-expect/gexpect/gexpecttest"
+)
+
+func TestFlushCtx(t *testing.T) {
+	type testcase struct {
+		name   string
+		config map[string]string
+		expect int
+	}
+
+	rules := map[string]string{
+		"key_int0": `{"key":"status", "condition":"<", "value":500}`,
+		"expect":   `$log exists severity warn`,
+	}
+	with := func(k, v string) map[string]string {
+		ret := map[string]string{k: v}
+		for k, v := range rules {
+			ret[k] = v
+		}
+		return ret
+	}
+
+	cases := []testcase{
+		{"log", rules, output.FLB_OK},
+		{"on_error", with("on_error", "error"), output.FLB_ERROR},
+		{"on_error retry", with("On_Error", "retry"), output.FLB_RETRY},
+		{"on_warn", with("on_warn", "error"), output.FLB_OK},
+	}
+
+	for _, v := range cases {
+		p := gexpecttest.New(v.config)
+		if ret := p.Init(); ret != output.FLB_OK {
+			t.Errorf("%s: Init error ret=%d", v.name, ret)
+			continue
+		}
+		ret, err := p.FlushJson("app.web", `[{"log":"a", "status":200}, {"log":"b", "status":503}]`)
+		if err != nil {
+			t.Errorf("%s: FlushJson err:%s", v.name, err)
+			continue
+		}
+		if ret != v.expect {
+			t.Errorf("%s: mismatch given=%d expect=%d", v.name, ret, v.expect)
+		}
+		reports := p.Reports()
+		if len(reports) != 1 || reports[0].Tag != "app.web" || len(reports[0].Failures) != 1 {
+			t.Errorf("%s: reports mismatch:%+v", v.name, reports)
+			continue
+		}
+		if f := reports[0].Failures[0]; f.RecordIndex != 1 || f.Expected != `"status" < 500` || f.Actual != int64(503) {
+			t.Errorf("%s: failure mismatch:%+v", v.name, f)
+		}
+		if _, ok := p.Exited(); ok {
+			t.Errorf("%s: should not exit", v.name)
+		}
+	}
+}
+
+func TestFlushCtxSeverity(t *testing.T) {
+	p := gexpecttest.New(map[string]string{
+		"expect":  `$log exists severity warn`,
+		"on_warn": "retry",
+	})
+	if ret := p.Init(); ret != output.FLB_OK {
+		t.Fatalf("Init error ret=%d", ret)
+	}
+	ret, err := p.FlushRecords("app", gexpecttest.Record{Time: time.Now(), Map: map[string]interface{}{"msg": "a"}})
+	if err != nil {
+		t.Fatalf("FlushRecords err:%s", err)
+	}
+	if ret != output.FLB_RETRY {
+		t.Errorf("mismatch given=%d expect=%d", ret, output.FLB_RETRY)
+	}
+	if fs := p.Failures(); len(fs) != 1 || fs[0].Expected != `exists "log"` {
+		t.Errorf("failures mismatch:%+v", fs)
+	}
+}
+
+func TestInitError(t *testing.T) {
+	type testcase struct {
+		name   string
+		config map[string]string
+		expect int
+	}
+
+	cases := []testcase{
+		{"not strict", map[string]string{"key_int0": `{"key":"a", "condition":">>", "value":1}`}, output.FLB_OK},
+		{"strict", map[string]string{"strict": "on", "key_int0": `{"key":"a", "condition":">>", "value":1}`}, output.FLB_ERROR},
+		{"invalid action", map[string]string{"strict": "on", "on_error": "abort"}, output.FLB_ERROR},
+		{"exit_code 0", map[string]string{"strict": "on", "exit_code": "0"}, output.FLB_ERROR},
+		{"sparse index", map[string]string{"strict": "on", "key_int0": `{"key":"a", "condition":">", "value":1}`, "key_int100": `{"key":"b", "condition":">>", "value":1}`}, output.FLB_ERROR},
+		{"duplicated", map[string]string{"key_int0": `{"key":"a","condition":">","value":1}`, "key_int1": `{"key": "a","condition":">","value":1}`}, output.FLB_OK},
+		{"strict duplicated", map[string]string{"strict": "on", "key_int0": `{"key":"a","condition":">","value":1}`, "key_int1": `{"key": "a","condition":">","value":1}`}, output.FLB_ERROR},
+		{"strict duplicated expect", map[string]string{"strict": "on", "key_int0": `{"key":"a","condition":">","value":1}`, "expect": `$a int > 1`}, output.FLB_ERROR},
+		{"rules_path", map[string]string{"rules_path": "/not/found.json"}, output.FLB_ERROR},
+	}
+
+	for _, v := range cases {
+		p := gexpecttest.New(v.config)
+		if ret := p.Init(); ret != v.expect {
+			t.Errorf("%s: mismatch given=%d expect=%d", v.name, ret, v.expect)
+		}
+	}
+}
+
+func TestInitRulesPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gexpect")
+	if err != nil {
+		t.Fatalf("TempDir err:%s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rules.json")
+	err = ioutil.WriteFile(path, []byte(`[{"type":"not_exists", "key":"a"}, {"type":"int", "key":"b", "condition":">", "value":1}]`), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile err:%s", err)
+	}
+
+	type testcase struct {
+		name   string
+		config map[string]string
+		expect int
+	}
+
+	cases := []testcase{
+		{"conflict of inline rules", map[string]string{"key_exists0": `{"key":"z"}`, "key_not_exists0": `{"key":"z"}`}, output.FLB_OK},
+		{"conflict with rules_path", map[string]string{"key_exists0": `{"key":"a"}`}, output.FLB_ERROR},
+		{"duplicated with rules_path", map[string]string{"key_int0": `{"key":"b", "condition":">", "value":1}`}, output.FLB_OK},
+		{"strict duplicated with rules_path", map[string]string{"strict": "on", "key_int0": `{"key":"b", "condition":">", "value":1}`}, output.FLB_ERROR},
+	}
+
+	for _, v := range cases {
+		v.config["rules_path"] = path
+		v.config["reload_interval"] = "0s"
+		p := gexpecttest.New(v.config)
+		if ret := p.Init(); ret != v.expect {
+			t.Errorf("%s: mismatch given=%d expect=%d", v.name, ret, v.expect)
+			continue
+		}
+		if v.expect != output.FLB_OK {
+			continue
+		}
+		if _, err := p.FlushJson("app", `{"b":0}`); err != nil {
+			t.Fatalf("%s: FlushJson err:%s", v.name, err)
+		}
+		if len(p.Failures()) == 0 {
+			t.Errorf("%s: rules of rules_path should be applied", v.name)
+		}
+		p.Exit()
+	}
+}
+
+func TestFlushCtxNoContext(t *testing.T) {
+	p := gexpecttest.New(map[string]string{})
+	if ret := p.Flush("app", nil); ret != output.FLB_ERROR {
+		t.Errorf("mismatch given=%d expect=%d", ret, output.FLB_ERROR)
+	}
+}
+
+func TestEventTime(t *testing.T) {
+	p := gexpecttest.New(map[string]string{
+		"event_time0": `{"condition":">", "value":"2021-01-01T00:00:00Z"}`,
+	})
+	if ret := p.Init(); ret != output.FLB_OK {
+		t.Fatalf("Init error ret=%d", ret)
+	}
+	_, err := p.FlushRecords("app",
+		gexpecttest.Record{Time: time.Date(2021, 4, 1, 12, 0, 0, 500, time.UTC)},
+		gexpecttest.Record{Time: time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)},
+	)
+	if err != nil {
+		t.Fatalf("FlushRecords err:%s", err)
+	}
+	fs := p.Failures()
+	if len(fs) != 1 || fs[0].RecordIndex != 1 {
+		t.Errorf("failures mismatch:%+v", fs)
+	}
+}
+
+func TestExit(t *testing.T) {
+	type testcase struct {
+		name   string
+		config map[string]string
+		json   string
+		ret    int
+		exited bool
+		code   int
+	}
+
+	rules := `$status int < 500`
+	cases := []testcase{
+		{"on_error exit", map[string]string{"expect": rules, "on_error": "exit", "exit_code": "4"}, `{"status":503}`, output.FLB_ERROR, true, 4},
+		{"test passed", map[string]string{"expect": rules, "test_records": "2", "exit_code": "3"}, `[{"status":200}, {"status":201}]`, output.FLB_OK, true, 0},
+		{"test failed", map[string]string{"expect": rules, "test_records": "2", "exit_code": "3"}, `[{"status":200}, {"status":503}]`, output.FLB_OK, true, 3},
+		{"test not finished", map[string]string{"expect": rules, "test_records": "3"}, `[{"status":200}, {"status":503}]`, output.FLB_OK, false, 0},
+	}
+
+	for _, v := range cases {
+		p := gexpecttest.New(v.config)
+		if ret := p.Init(); ret != output.FLB_OK {
+			t.Errorf("%s: Init error ret=%d", v.name, ret)
+			continue
+		}
+		ret, err := p.FlushJson("app", v.json)
+		if err != nil {
+			t.Errorf("%s: FlushJson err:%s", v.name, err)
+			continue
+		}
+		if ret != v.ret {
+			t.Errorf("%s: mismatch given=%d expect=%d", v.name, ret, v.ret)
+		}
+		code, exited := p.Exited()
+		if exited != v.exited || code != v.code {
+			t.Errorf("%s: exit mismatch given=%d,%t expect=%d,%t", v.name, code, exited, v.code, v.exited)
+		}
+	}
+}
+
+func TestTestTimeout(t *testing.T) {
+	type testcase struct {
+		name   string
+		config map[string]string
+		json   string // no flush if empty
+	}
+
+	cases := []testcase{
+		{"failed", map[string]string{"expect": `$status int < 500`, "test_timeout": "10ms"}, `{"status":503}`},
+		{"no record", map[string]string{"expect": `$status int < 500`, "test_timeout": "10ms"}, ""},
+		{"test_records not reached", map[string]string{"expect": `$status int < 500`, "test_timeout": "10ms", "test_records": "3"}, `{"status":200}`},
+	}
+
+	for _, v := range cases {
+		p := gexpecttest.New(v.config)
+		if ret := p.Init(); ret != output.FLB_OK {
+			t.Fatalf("%s: Init error ret=%d", v.name, ret)
+		}
+		if v.json != "" {
+			if _, err := p.FlushJson("app", v.json); err != nil {
+				t.Fatalf("%s: FlushJson err:%s", v.name, err)
+			}
+		}
+		code, ok := p.WaitExit(time.Second)
+		if !ok || code != expect.DefaultExitCode {
+			t.Errorf("%s: exit mismatch given=%d,%t", v.name, code, ok)
+		}
+		if ret := p.Exit(); ret != output.FLB_OK {
+			t.Errorf("%s: Exit error ret=%d", v.name, ret)
+		}
+	}
+}
+
+func TestExitCtx(t *testing.T) {
+	config := map[string]string{
+		"expect":       `$status int < 500`,
+		"test_timeout": "50ms",
+	}
+	p1 := gexpecttest.New(config)
+	p2 := gexpecttest.New(config)
+	for _, p := range []*gexpecttest.Plugin{p1, p2} {
+		if ret := p.Init(); ret != output.FLB_OK {
+			t.Fatalf("Init error ret=%d", ret)
+		}
+	}
+	if ret := p1.Exit(); ret != output.FLB_OK {
+		t.Errorf("Exit error ret=%d", ret)
+	}
+	if code, ok := p2.WaitExit(time.Second); !ok || code != expect.DefaultExitCode {
+		t.Errorf("other instance should keep running. exit=%d,%t", code, ok)
+	}
+	if code, ok := p1.WaitExit(100 * time.Millisecond); ok {
+		t.Errorf("timer of exited instance should be stopped. exit=%d", code)
+	}
+	if ret := p2.Exit(); ret != output.FLB_OK {
+		t.Errorf("Exit error ret=%d", ret)
+	}
+}
+
+func TestInitFindingParam(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	p := gexpecttest.New(map[string]string{
+		"key_exists0":     `{"key":"a"}`,
+		"key_int0":        `{"key":"b", "condition":">", "value":1}`,
+		"key_not_exists0": `{"key":"a"}`,
+	})
+	if ret := p.Init(); ret != output.FLB_OK {
+		t.Fatalf("Init error ret=%d", ret)
+	}
+	expect := `key_not_exists0 config error=[error] conflict key:"a"`
+	if !strings.Contains(buf.String(), expect) {
+		t.Errorf("mismatch:\n given :%s\n expect:%s", buf.String(), expect)
+	}
+
+	buf.Reset()
+	p = gexpecttest.New(map[string]string{
+		"key_int0": `{"key":"b", "condition":">", "value":1}`,
+		"expect":   `$b int > 1`,
+	})
+	if ret := p.Init(); ret != output.FLB_OK {
+		t.Fatalf("Init error ret=%d", ret)
+	}
+	expect = `expect[0],key_int0 [warning] "b" > 1 is duplicated`
+	if !strings.Contains(buf.String(), expect) {
+		t.Errorf("mismatch:\n given :%s\n expect:%s", buf.String(), expect)
+	}
+}
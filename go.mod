@@ -2,4 +2,8 @@ module github.com/nokute78/fluentbit-plugin-out-expect
 
 go 1.15
 
-require github.com/fluent/fluent-bit-go v0.0.0-20201210173045-3fd1e0486df2
+require (
+	github.com/fluent/fluent-bit-go v0.0.0-20201210173045-3fd1e0486df2
+	github.com/ugorji/go/codec v1.1.7
+	gopkg.in/yaml.v3 v3.0.1
+)